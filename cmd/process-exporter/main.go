@@ -160,6 +160,10 @@ func main() {
 			"comma-separated list of process names to monitor")
 		procfsPath = flag.String("procfs", "/proc",
 			"path to read proc data from")
+		cgroupfsPath = flag.String("cgroupfs", "/sys/fs/cgroup",
+			"path where the cgroup v2 hierarchy is mounted, for -gather-psi")
+		gatherPSI = flag.Bool("gather-psi", false,
+			"gather pressure stall information of the cgroup v2 cgroups of each group")
 		nameMapping = flag.String("namemapping", "",
 			"comma-separated list, alternating process name and capturing regex to apply to cmdline")
 		children = flag.Bool("children", true,
@@ -168,6 +172,18 @@ func main() {
 			"report on per-threadname metrics as well")
 		smaps = flag.Bool("gather-smaps", true,
 			"gather metrics from smaps file, which contains proportional resident memory size")
+		fdTypes = flag.Bool("gather-fd-types", false,
+			"break down open file descriptors by type, e.g. socket or pipe, at the cost of reading each fd's link")
+		deletedFiles = flag.Bool("gather-deleted-files", false,
+			"report deleted files still held open, at the cost of reading each fd's link")
+		numaMaps = flag.Bool("gather-numa-maps", false,
+			"gather memory per NUMA node from /proc/[pid]/numa_maps, which is slow on processes with many memory maps")
+		cpuPlacement = flag.Bool("cpu-placement", false,
+			"report how many threads last ran on each CPU and how many CPUs procs may run on, adding a metric per CPU to each group")
+		netns = flag.Bool("gather-netns-traffic", false,
+			"count the traffic of network namespaces other than the host's in the group of their tracked process with the lowest pid")
+		sockets = flag.Bool("gather-sockets", false,
+			"count TCP and UDP sockets by state, at the cost of reading each fd's link and the socket tables")
 		man = flag.Bool("man", false,
 			"print manual")
 		configPath = flag.String("config.path", "",
@@ -242,12 +258,24 @@ func main() {
 		*recheck = true
 	}
 
+	var pressureCgroupfs string
+	if *gatherPSI {
+		pressureCgroupfs = *cgroupfsPath
+	}
+
 	pc, err := collector.NewProcessCollector(
 		collector.ProcessCollectorOption{
 			ProcFSPath:        *procfsPath,
 			Children:          *children,
 			Threads:           *threads,
 			GatherSMaps:       *smaps,
+			GatherFDTypes:     *fdTypes,
+			GatherDeleted:     *deletedFiles,
+			GatherSockets:     *sockets,
+			GatherNetNS:       *netns,
+			GatherNUMAMaps:    *numaMaps,
+			CPUPlacement:      *cpuPlacement,
+			CgroupFSPath:      pressureCgroupfs,
 			Namer:             matchnamer,
 			Recheck:           *recheck,
 			RecheckTimeLimit:  *recheckTimeLimit,
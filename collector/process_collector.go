@@ -2,6 +2,9 @@ package collector
 
 import (
 	"log"
+	"math"
+	"sort"
+	"strconv"
 	"time"
 
 	common "github.com/ncabatoff/process-exporter"
@@ -22,6 +25,24 @@ var (
 		[]string{"groupname", "mode"},
 		nil)
 
+	cpuWaitSecsDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_cpu_wait_seconds_total",
+		"Time spent waiting for a CPU while runnable, in seconds",
+		[]string{"groupname"},
+		nil)
+
+	blkioDelaySecsDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_blkio_delay_seconds_total",
+		"Time spent waiting for block I/O, in seconds",
+		[]string{"groupname"},
+		nil)
+
+	timeslicesDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_timeslices_total",
+		"Number of times this group was run on a CPU",
+		[]string{"groupname"},
+		nil)
+
 	readBytesDesc = prometheus.NewDesc(
 		"namedprocess_namegroup_read_bytes_total",
 		"number of bytes read by this group",
@@ -34,6 +55,24 @@ var (
 		[]string{"groupname"},
 		nil)
 
+	ioSyscallsDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_io_syscalls_total",
+		"number of read/write syscalls made by this group",
+		[]string{"groupname", "op"},
+		nil)
+
+	logicalBytesDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_logical_bytes_total",
+		"number of bytes read/written by this group's syscalls, whether or not storage I/O was needed",
+		[]string{"groupname", "direction"},
+		nil)
+
+	cancelledWriteBytesDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_cancelled_write_bytes_total",
+		"number of bytes this group caused not to be written, by truncating dirty page cache",
+		[]string{"groupname"},
+		nil)
+
 	majorPageFaultsDesc = prometheus.NewDesc(
 		"namedprocess_namegroup_major_page_faults_total",
 		"Major page faults",
@@ -64,12 +103,108 @@ var (
 		[]string{"groupname"},
 		nil)
 
+	openFDsByTypeDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_open_filedesc_by_type",
+		"number of open file descriptors of each type for this group",
+		[]string{"groupname", "fdtype"},
+		nil)
+
+	deletedOpenFilesDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_deleted_open_files",
+		"number of deleted files still open in this group",
+		[]string{"groupname"},
+		nil)
+
+	deletedOpenBytesDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_deleted_open_bytes",
+		"total size of the deleted files still open in this group",
+		[]string{"groupname"},
+		nil)
+
+	networkBytesDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_network_bytes_total",
+		"bytes received and transmitted by the network namespaces owned by this group",
+		[]string{"groupname", "direction"},
+		nil)
+
+	networkPacketsDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_network_packets_total",
+		"packets received and transmitted by the network namespaces owned by this group",
+		[]string{"groupname", "direction"},
+		nil)
+
+	networkDropsDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_network_drops_total",
+		"packets dropped while receiving and transmitting by the network namespaces owned by this group",
+		[]string{"groupname", "direction"},
+		nil)
+
+	socketsDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_sockets",
+		"number of TCP and UDP sockets open in this group, by protocol and state",
+		[]string{"groupname", "proto", "state"},
+		nil)
+
+	listenQueueDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_listen_queue",
+		"connections waiting to be accepted on the TCP ports this group listens on",
+		[]string{"groupname", "port"},
+		nil)
+
 	worstFDRatioDesc = prometheus.NewDesc(
 		"namedprocess_namegroup_worst_fd_ratio",
 		"the worst (closest to 1) ratio between open fds and max fds among all procs in this group",
 		[]string{"groupname"},
 		nil)
 
+	numaMemoryBytesDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_numa_memory_bytes",
+		"memory of the procs in this group on each NUMA node",
+		[]string{"groupname", "node"},
+		nil)
+
+	lastCPUThreadsDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_last_cpu_threads",
+		"number of threads in this group that last ran on each CPU",
+		[]string{"groupname", "cpu"},
+		nil)
+
+	cpusAllowedDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_max_cpus_allowed",
+		"the most CPUs any proc in this group is allowed to run on",
+		[]string{"groupname"},
+		nil)
+
+	pressureDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_pressure_seconds_total",
+		"time tasks in the cgroups of this group stalled waiting for a resource, from cgroup v2 PSI",
+		[]string{"groupname", "resource", "stall"},
+		nil)
+
+	memoryMapsDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_memory_maps",
+		"number of memory maps of the procs in this group",
+		[]string{"groupname"},
+		nil)
+
+	worstMapCountRatioDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_worst_map_count_ratio",
+		"the worst (closest to 1) ratio between memory maps and vm.max_map_count among all procs in this group",
+		[]string{"groupname"},
+		nil)
+
+	limitDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_limit",
+		"the lowest soft limit on each resource among all procs in this group",
+		[]string{"groupname", "resource"},
+		nil)
+
+	worstLimitRatioDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_worst_limit_ratio",
+		"the worst (closest to 1) ratio between usage and soft limit of each measurable resource among all procs in this group",
+		[]string{"groupname", "resource"},
+		nil)
+
 	startTimeDesc = prometheus.NewDesc(
 		"namedprocess_namegroup_oldest_start_time_seconds",
 		"start time in seconds since 1970/01/01 of oldest process in group",
@@ -82,6 +217,18 @@ var (
 		[]string{"groupname"},
 		nil)
 
+	schedPolicyThreadsDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_sched_policy_threads",
+		"number of threads in this group with each scheduling policy",
+		[]string{"groupname", "policy"},
+		nil)
+
+	niceThreadsDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_nice_threads",
+		"number of threads in this group with each nice value",
+		[]string{"groupname", "nice"},
+		nil)
+
 	statesDesc = prometheus.NewDesc(
 		"namedprocess_namegroup_states",
 		"Number of processes in states Running, Sleeping, Waiting, Zombie, or Other",
@@ -124,12 +271,36 @@ var (
 		[]string{"groupname", "threadname", "mode"},
 		nil)
 
+	threadCpuWaitSecsDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_thread_cpu_wait_seconds_total",
+		"Time these threads spent waiting for a CPU while runnable, in seconds",
+		[]string{"groupname", "threadname"},
+		nil)
+
 	threadIoBytesDesc = prometheus.NewDesc(
 		"namedprocess_namegroup_thread_io_bytes_total",
 		"number of bytes read/written by these threads",
 		[]string{"groupname", "threadname", "iomode"},
 		nil)
 
+	threadIoSyscallsDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_thread_io_syscalls_total",
+		"number of read/write syscalls made by these threads",
+		[]string{"groupname", "threadname", "op"},
+		nil)
+
+	threadLogicalBytesDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_thread_logical_bytes_total",
+		"number of bytes read/written by these threads' syscalls, whether or not storage I/O was needed",
+		[]string{"groupname", "threadname", "direction"},
+		nil)
+
+	threadCancelledWriteBytesDesc = prometheus.NewDesc(
+		"namedprocess_namegroup_thread_cancelled_write_bytes_total",
+		"number of bytes these threads caused not to be written, by truncating dirty page cache",
+		[]string{"groupname", "threadname"},
+		nil)
+
 	threadMajorPageFaultsDesc = prometheus.NewDesc(
 		"namedprocess_namegroup_thread_major_page_faults_total",
 		"Major page faults for these threads",
@@ -160,6 +331,13 @@ type (
 		Children          bool
 		Threads           bool
 		GatherSMaps       bool
+		GatherFDTypes     bool
+		GatherDeleted     bool
+		GatherSockets     bool
+		GatherNetNS       bool
+		GatherNUMAMaps    bool
+		CPUPlacement      bool
+		CgroupFSPath      string
 		Namer             common.MatchNamer
 		Recheck           bool
 		RecheckTimeLimit  time.Duration
@@ -172,11 +350,22 @@ type (
 		*proc.Grouper
 		threads              bool
 		smaps                bool
+		fdTypes              bool
+		deleted              bool
+		sockets              bool
+		netns                bool
+		numaMaps             bool
+		cpuPlacement         bool
+		pressure             bool
 		source               proc.Source
 		scrapeErrors         int
 		scrapeProcReadErrors int
 		scrapePartialErrors  int
 		debug                bool
+		// infoDesc describes namedprocess_namegroup_info, or is nil if
+		// no rule in the namer carries metadata.
+		infoDesc     *prometheus.Desc
+		metadataKeys []string
 	}
 )
 
@@ -187,13 +376,37 @@ func NewProcessCollector(options ProcessCollectorOption) (*NamedProcessCollector
 	}
 
 	fs.GatherSMaps = options.GatherSMaps
+	fs.GatherFDTypes = options.GatherFDTypes
+	fs.GatherDeletedFiles = options.GatherDeleted
+	fs.GatherSockets = options.GatherSockets
+	fs.GatherNetNS = options.GatherNetNS
+	fs.GatherNUMAMaps = options.GatherNUMAMaps
+	fs.CgroupMountPoint = options.CgroupFSPath
 	p := &NamedProcessCollector{
-		scrapeChan: make(chan scrapeRequest),
-		Grouper:    proc.NewGrouper(options.Namer, options.Children, options.Threads, options.Recheck, options.RecheckTimeLimit, options.Debug, options.RemoveEmptyGroups),
-		source:     fs,
-		threads:    options.Threads,
-		smaps:      options.GatherSMaps,
-		debug:      options.Debug,
+		scrapeChan:   make(chan scrapeRequest),
+		Grouper:      proc.NewGrouper(options.Namer, options.Children, options.Threads, options.Recheck, options.RecheckTimeLimit, options.Debug, options.RemoveEmptyGroups),
+		source:       fs,
+		threads:      options.Threads,
+		smaps:        options.GatherSMaps,
+		fdTypes:      options.GatherFDTypes,
+		deleted:      options.GatherDeleted,
+		sockets:      options.GatherSockets,
+		netns:        options.GatherNetNS,
+		numaMaps:     options.GatherNUMAMaps,
+		cpuPlacement: options.CPUPlacement,
+		pressure:     options.CgroupFSPath != "",
+		debug:        options.Debug,
+	}
+
+	if mn, ok := options.Namer.(common.RuleMatchNamer); ok {
+		if keys := mn.MetadataKeys(); len(keys) > 0 {
+			p.metadataKeys = keys
+			p.infoDesc = prometheus.NewDesc(
+				"namedprocess_namegroup_info",
+				"metadata about this group from the config file, always 1",
+				append([]string{"groupname"}, keys...),
+				nil)
+		}
 	}
 
 	colErrs, _, err := p.Update(p.source.AllProcs())
@@ -214,28 +427,73 @@ func NewProcessCollector(options ProcessCollectorOption) (*NamedProcessCollector
 // Describe implements prometheus.Collector.
 func (p *NamedProcessCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- cpuSecsDesc
+	ch <- cpuWaitSecsDesc
+	ch <- timeslicesDesc
+	ch <- blkioDelaySecsDesc
 	ch <- numprocsDesc
 	ch <- readBytesDesc
 	ch <- writeBytesDesc
+	ch <- ioSyscallsDesc
+	ch <- logicalBytesDesc
+	ch <- cancelledWriteBytesDesc
 	ch <- membytesDesc
 	ch <- openFDsDesc
 	ch <- worstFDRatioDesc
+	ch <- memoryMapsDesc
+	ch <- worstMapCountRatioDesc
+	if p.fdTypes {
+		ch <- openFDsByTypeDesc
+	}
+	if p.deleted {
+		ch <- deletedOpenFilesDesc
+		ch <- deletedOpenBytesDesc
+	}
+	if p.numaMaps {
+		ch <- numaMemoryBytesDesc
+	}
+	if p.pressure {
+		ch <- pressureDesc
+	}
+	if p.cpuPlacement {
+		ch <- lastCPUThreadsDesc
+		ch <- cpusAllowedDesc
+	}
+	if p.netns {
+		ch <- networkBytesDesc
+		ch <- networkPacketsDesc
+		ch <- networkDropsDesc
+	}
+	if p.sockets {
+		ch <- socketsDesc
+		ch <- listenQueueDesc
+	}
+	ch <- limitDesc
+	ch <- worstLimitRatioDesc
 	ch <- startTimeDesc
 	ch <- majorPageFaultsDesc
 	ch <- minorPageFaultsDesc
 	ch <- contextSwitchesDesc
 	ch <- numThreadsDesc
 	ch <- statesDesc
+	ch <- schedPolicyThreadsDesc
+	ch <- niceThreadsDesc
 	ch <- scrapeErrorsDesc
 	ch <- scrapeProcReadErrorsDesc
 	ch <- scrapePartialErrorsDesc
 	ch <- threadWchanDesc
 	ch <- threadCountDesc
 	ch <- threadCpuSecsDesc
+	ch <- threadCpuWaitSecsDesc
 	ch <- threadIoBytesDesc
+	ch <- threadIoSyscallsDesc
+	ch <- threadLogicalBytesDesc
+	ch <- threadCancelledWriteBytesDesc
 	ch <- threadMajorPageFaultsDesc
 	ch <- threadMinorPageFaultsDesc
 	ch <- threadContextSwitchesDesc
+	if p.infoDesc != nil {
+		ch <- p.infoDesc
+	}
 }
 
 // Collect implements prometheus.Collector.
@@ -269,20 +527,74 @@ func (p *NamedProcessCollector) scrape(ch chan<- prometheus.Metric) {
 				prometheus.GaugeValue, float64(gcounts.Memory.VirtualBytes), gname, "virtual")
 			ch <- prometheus.MustNewConstMetric(membytesDesc,
 				prometheus.GaugeValue, float64(gcounts.Memory.VmSwapBytes), gname, "swapped")
+			ch <- prometheus.MustNewConstMetric(membytesDesc,
+				prometheus.GaugeValue, float64(gcounts.Memory.RssAnonBytes), gname, "residentAnon")
+			ch <- prometheus.MustNewConstMetric(membytesDesc,
+				prometheus.GaugeValue, float64(gcounts.Memory.RssFileBytes), gname, "residentFile")
+			ch <- prometheus.MustNewConstMetric(membytesDesc,
+				prometheus.GaugeValue, float64(gcounts.Memory.RssShmemBytes), gname, "residentShmem")
+			ch <- prometheus.MustNewConstMetric(membytesDesc,
+				prometheus.GaugeValue, float64(gcounts.Memory.VmHWMBytes), gname, "peakResident")
+			ch <- prometheus.MustNewConstMetric(membytesDesc,
+				prometheus.GaugeValue, float64(gcounts.Memory.VmLckBytes), gname, "locked")
+			ch <- prometheus.MustNewConstMetric(membytesDesc,
+				prometheus.GaugeValue, float64(gcounts.Memory.VmPTEBytes), gname, "pageTables")
+			ch <- prometheus.MustNewConstMetric(membytesDesc,
+				prometheus.GaugeValue, float64(gcounts.Memory.HugetlbBytes), gname, "hugetlb")
 			ch <- prometheus.MustNewConstMetric(startTimeDesc,
 				prometheus.GaugeValue, float64(gcounts.OldestStartTime.Unix()), gname)
 			ch <- prometheus.MustNewConstMetric(openFDsDesc,
 				prometheus.GaugeValue, float64(gcounts.OpenFDs), gname)
 			ch <- prometheus.MustNewConstMetric(worstFDRatioDesc,
 				prometheus.GaugeValue, float64(gcounts.WorstFDratio), gname)
+			ch <- prometheus.MustNewConstMetric(memoryMapsDesc,
+				prometheus.GaugeValue, float64(gcounts.Memory.MapCount), gname)
+			ch <- prometheus.MustNewConstMetric(worstMapCountRatioDesc,
+				prometheus.GaugeValue, gcounts.WorstMapCountRatio, gname)
+			for res, soft := range gcounts.Limits {
+				limit := float64(soft)
+				if soft == proc.RLimInfinity {
+					limit = math.Inf(1)
+				}
+				ch <- prometheus.MustNewConstMetric(limitDesc,
+					prometheus.GaugeValue, limit, gname, res)
+			}
+			for res, ratio := range gcounts.WorstLimitRatio {
+				ch <- prometheus.MustNewConstMetric(worstLimitRatioDesc,
+					prometheus.GaugeValue, ratio, gname, res)
+			}
 			ch <- prometheus.MustNewConstMetric(cpuSecsDesc,
 				prometheus.CounterValue, gcounts.CPUUserTime, gname, "user")
 			ch <- prometheus.MustNewConstMetric(cpuSecsDesc,
 				prometheus.CounterValue, gcounts.CPUSystemTime, gname, "system")
+			ch <- prometheus.MustNewConstMetric(cpuSecsDesc,
+				prometheus.CounterValue, gcounts.CPUGuestTime, gname, "guest")
+			ch <- prometheus.MustNewConstMetric(cpuSecsDesc,
+				prometheus.CounterValue, gcounts.CPUChildrenUserTime, gname, "children_user")
+			ch <- prometheus.MustNewConstMetric(cpuSecsDesc,
+				prometheus.CounterValue, gcounts.CPUChildrenSystemTime, gname, "children_system")
+			ch <- prometheus.MustNewConstMetric(cpuSecsDesc,
+				prometheus.CounterValue, gcounts.CPUChildrenGuestTime, gname, "children_guest")
+			ch <- prometheus.MustNewConstMetric(blkioDelaySecsDesc,
+				prometheus.CounterValue, gcounts.BlkIODelayTime, gname)
+			ch <- prometheus.MustNewConstMetric(cpuWaitSecsDesc,
+				prometheus.CounterValue, gcounts.CPUWaitTime, gname)
+			ch <- prometheus.MustNewConstMetric(timeslicesDesc,
+				prometheus.CounterValue, float64(gcounts.Timeslices), gname)
 			ch <- prometheus.MustNewConstMetric(readBytesDesc,
 				prometheus.CounterValue, float64(gcounts.ReadBytes), gname)
 			ch <- prometheus.MustNewConstMetric(writeBytesDesc,
 				prometheus.CounterValue, float64(gcounts.WriteBytes), gname)
+			ch <- prometheus.MustNewConstMetric(ioSyscallsDesc,
+				prometheus.CounterValue, float64(gcounts.ReadSyscalls), gname, "read")
+			ch <- prometheus.MustNewConstMetric(ioSyscallsDesc,
+				prometheus.CounterValue, float64(gcounts.WriteSyscalls), gname, "write")
+			ch <- prometheus.MustNewConstMetric(logicalBytesDesc,
+				prometheus.CounterValue, float64(gcounts.LogicalReadBytes), gname, "read")
+			ch <- prometheus.MustNewConstMetric(logicalBytesDesc,
+				prometheus.CounterValue, float64(gcounts.LogicalWriteBytes), gname, "write")
+			ch <- prometheus.MustNewConstMetric(cancelledWriteBytesDesc,
+				prometheus.CounterValue, float64(gcounts.CancelledWriteBytes), gname)
 			ch <- prometheus.MustNewConstMetric(majorPageFaultsDesc,
 				prometheus.CounterValue, float64(gcounts.MajorPageFaults), gname)
 			ch <- prometheus.MustNewConstMetric(minorPageFaultsDesc,
@@ -304,6 +616,31 @@ func (p *NamedProcessCollector) scrape(ch chan<- prometheus.Metric) {
 			ch <- prometheus.MustNewConstMetric(statesDesc,
 				prometheus.GaugeValue, float64(gcounts.States.Other), gname, "Other")
 
+			policies := make(map[string]uint64)
+			for _, name := range proc.PolicyNames() {
+				policies[name] = 0
+			}
+			for policy, count := range gcounts.SchedPolicies {
+				policies[proc.PolicyName(policy)] += count
+			}
+			for policy, count := range policies {
+				ch <- prometheus.MustNewConstMetric(schedPolicyThreadsDesc,
+					prometheus.GaugeValue, float64(count), gname, policy)
+			}
+			for nice, count := range gcounts.Nices {
+				ch <- prometheus.MustNewConstMetric(niceThreadsDesc,
+					prometheus.GaugeValue, float64(count), gname, strconv.Itoa(nice))
+			}
+
+			if p.infoDesc != nil && gcounts.Procs > 0 {
+				values := []string{gname}
+				for _, k := range p.metadataKeys {
+					values = append(values, gcounts.Metadata[k])
+				}
+				ch <- prometheus.MustNewConstMetric(p.infoDesc,
+					prometheus.GaugeValue, 1, values...)
+			}
+
 			for wchan, count := range gcounts.Wchans {
 				ch <- prometheus.MustNewConstMetric(threadWchanDesc,
 					prometheus.GaugeValue, float64(count), gname, wchan)
@@ -314,6 +651,92 @@ func (p *NamedProcessCollector) scrape(ch chan<- prometheus.Metric) {
 					prometheus.GaugeValue, float64(gcounts.Memory.ProportionalBytes), gname, "proportionalResident")
 				ch <- prometheus.MustNewConstMetric(membytesDesc,
 					prometheus.GaugeValue, float64(gcounts.Memory.ProportionalSwapBytes), gname, "proportionalSwapped")
+				ch <- prometheus.MustNewConstMetric(membytesDesc,
+					prometheus.GaugeValue, float64(gcounts.Memory.UniqueBytes), gname, "unique")
+				ch <- prometheus.MustNewConstMetric(membytesDesc,
+					prometheus.GaugeValue, float64(gcounts.Memory.AnonHugePagesBytes), gname, "anonHugePages")
+			}
+
+			if p.fdTypes {
+				for fdType, count := range gcounts.OpenFDsByType {
+					ch <- prometheus.MustNewConstMetric(openFDsByTypeDesc,
+						prometheus.GaugeValue, float64(count), gname, fdType)
+				}
+			}
+
+			if p.deleted {
+				var bytes uint64
+				for _, size := range gcounts.DeletedFiles {
+					bytes += size
+				}
+				ch <- prometheus.MustNewConstMetric(deletedOpenFilesDesc,
+					prometheus.GaugeValue, float64(len(gcounts.DeletedFiles)), gname)
+				ch <- prometheus.MustNewConstMetric(deletedOpenBytesDesc,
+					prometheus.GaugeValue, float64(bytes), gname)
+			}
+
+			if p.numaMaps {
+				for node, bytes := range gcounts.Memory.NUMANodeBytes {
+					ch <- prometheus.MustNewConstMetric(numaMemoryBytesDesc,
+						prometheus.GaugeValue, float64(bytes), gname, strconv.Itoa(node))
+				}
+			}
+
+			if p.pressure {
+				for _, psi := range []struct {
+					resource, stall string
+					seconds         float64
+				}{
+					{"cpu", "some", gcounts.Pressure.CPUSome},
+					{"cpu", "full", gcounts.Pressure.CPUFull},
+					{"memory", "some", gcounts.Pressure.MemorySome},
+					{"memory", "full", gcounts.Pressure.MemoryFull},
+					{"io", "some", gcounts.Pressure.IOSome},
+					{"io", "full", gcounts.Pressure.IOFull},
+				} {
+					ch <- prometheus.MustNewConstMetric(pressureDesc,
+						prometheus.CounterValue, psi.seconds, gname, psi.resource, psi.stall)
+				}
+			}
+
+			if p.cpuPlacement {
+				for cpu, count := range gcounts.LastCPUs {
+					ch <- prometheus.MustNewConstMetric(lastCPUThreadsDesc,
+						prometheus.GaugeValue, float64(count), gname, strconv.Itoa(cpu))
+				}
+				ch <- prometheus.MustNewConstMetric(cpusAllowedDesc,
+					prometheus.GaugeValue, float64(gcounts.MaxCPUsAllowed), gname)
+			}
+
+			if p.netns {
+				ch <- prometheus.MustNewConstMetric(networkBytesDesc,
+					prometheus.CounterValue, float64(gcounts.NetRxBytes), gname, "received")
+				ch <- prometheus.MustNewConstMetric(networkBytesDesc,
+					prometheus.CounterValue, float64(gcounts.NetTxBytes), gname, "transmitted")
+				ch <- prometheus.MustNewConstMetric(networkPacketsDesc,
+					prometheus.CounterValue, float64(gcounts.NetRxPackets), gname, "received")
+				ch <- prometheus.MustNewConstMetric(networkPacketsDesc,
+					prometheus.CounterValue, float64(gcounts.NetTxPackets), gname, "transmitted")
+				ch <- prometheus.MustNewConstMetric(networkDropsDesc,
+					prometheus.CounterValue, float64(gcounts.NetRxDrops), gname, "received")
+				ch <- prometheus.MustNewConstMetric(networkDropsDesc,
+					prometheus.CounterValue, float64(gcounts.NetTxDrops), gname, "transmitted")
+			}
+
+			if p.sockets {
+				type protoState struct{ proto, state string }
+				counts := make(map[protoState]int)
+				for _, sock := range gcounts.Sockets {
+					counts[protoState{sock.Proto, sock.State}]++
+				}
+				for ps, count := range counts {
+					ch <- prometheus.MustNewConstMetric(socketsDesc,
+						prometheus.GaugeValue, float64(count), gname, ps.proto, ps.state)
+				}
+				for port, queue := range listenQueues(gcounts.Sockets) {
+					ch <- prometheus.MustNewConstMetric(listenQueueDesc,
+						prometheus.GaugeValue, float64(queue), gname, port)
+				}
 			}
 
 			if p.threads {
@@ -327,12 +750,30 @@ func (p *NamedProcessCollector) scrape(ch chan<- prometheus.Metric) {
 					ch <- prometheus.MustNewConstMetric(threadCpuSecsDesc,
 						prometheus.CounterValue, float64(thr.CPUSystemTime),
 						gname, thr.Name, "system")
+					ch <- prometheus.MustNewConstMetric(threadCpuWaitSecsDesc,
+						prometheus.CounterValue, thr.CPUWaitTime,
+						gname, thr.Name)
 					ch <- prometheus.MustNewConstMetric(threadIoBytesDesc,
 						prometheus.CounterValue, float64(thr.ReadBytes),
 						gname, thr.Name, "read")
 					ch <- prometheus.MustNewConstMetric(threadIoBytesDesc,
 						prometheus.CounterValue, float64(thr.WriteBytes),
 						gname, thr.Name, "write")
+					ch <- prometheus.MustNewConstMetric(threadIoSyscallsDesc,
+						prometheus.CounterValue, float64(thr.ReadSyscalls),
+						gname, thr.Name, "read")
+					ch <- prometheus.MustNewConstMetric(threadIoSyscallsDesc,
+						prometheus.CounterValue, float64(thr.WriteSyscalls),
+						gname, thr.Name, "write")
+					ch <- prometheus.MustNewConstMetric(threadLogicalBytesDesc,
+						prometheus.CounterValue, float64(thr.LogicalReadBytes),
+						gname, thr.Name, "read")
+					ch <- prometheus.MustNewConstMetric(threadLogicalBytesDesc,
+						prometheus.CounterValue, float64(thr.LogicalWriteBytes),
+						gname, thr.Name, "write")
+					ch <- prometheus.MustNewConstMetric(threadCancelledWriteBytesDesc,
+						prometheus.CounterValue, float64(thr.CancelledWriteBytes),
+						gname, thr.Name)
 					ch <- prometheus.MustNewConstMetric(threadMajorPageFaultsDesc,
 						prometheus.CounterValue, float64(thr.MajorPageFaults),
 						gname, thr.Name)
@@ -356,3 +797,36 @@ func (p *NamedProcessCollector) scrape(ch chan<- prometheus.Metric) {
 	ch <- prometheus.MustNewConstMetric(scrapePartialErrorsDesc,
 		prometheus.CounterValue, float64(p.scrapePartialErrors))
 }
+
+// maxListenQueuePorts bounds the number of ports listen_queue reports per
+// group.
+const maxListenQueuePorts = 20
+
+// listenQueues returns the accept queue depth of the listening TCP sockets
+// by port.  Sockets sharing a port, e.g. with SO_REUSEPORT, are summed.
+// Only the lowest maxListenQueuePorts ports are reported individually, the
+// others are summed as port "other".
+func listenQueues(sockets map[uint64]proc.Socket) map[string]uint64 {
+	byPort := make(map[int]uint64)
+	for _, sock := range sockets {
+		if sock.Proto == "tcp" && sock.State == "LISTEN" {
+			// For a listening socket rx_queue is the accept queue depth.
+			byPort[sock.LocalPort] += sock.RxQueue
+		}
+	}
+	ports := make([]int, 0, len(byPort))
+	for port := range byPort {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+
+	queues := make(map[string]uint64)
+	for i, port := range ports {
+		if i < maxListenQueuePorts {
+			queues[strconv.Itoa(port)] = byPort[port]
+		} else {
+			queues["other"] += byPort[port]
+		}
+	}
+	return queues
+}
@@ -0,0 +1,61 @@
+package collector
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ncabatoff/process-exporter/proc"
+)
+
+func TestListenQueues(t *testing.T) {
+	// manyPorts listens on ports 1 to 22, with as many connections queued.
+	manyPorts := make(map[uint64]proc.Socket)
+	manyWant := map[string]uint64{"other": 21 + 22}
+	for port := 1; port <= 22; port++ {
+		manyPorts[uint64(port)] = proc.Socket{Proto: "tcp", State: "LISTEN", LocalPort: port, RxQueue: uint64(port)}
+		if port <= maxListenQueuePorts {
+			manyWant[strconv.Itoa(port)] = uint64(port)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		sockets map[uint64]proc.Socket
+		want    map[string]uint64
+	}{
+		{
+			"none",
+			nil,
+			map[string]uint64{},
+		},
+		{
+			"listening tcp only",
+			map[uint64]proc.Socket{
+				1: {Proto: "tcp", State: "LISTEN", LocalPort: 80, RxQueue: 3},
+				2: {Proto: "tcp", State: "ESTABLISHED", LocalPort: 80, RxQueue: 100},
+				3: {Proto: "udp", State: "UNCONN", LocalPort: 53, RxQueue: 200},
+			},
+			map[string]uint64{"80": 3},
+		},
+		{
+			"reuseport summed",
+			map[uint64]proc.Socket{
+				1: {Proto: "tcp", State: "LISTEN", LocalPort: 8080, RxQueue: 2},
+				2: {Proto: "tcp", State: "LISTEN", LocalPort: 8080, RxQueue: 5},
+				3: {Proto: "tcp", State: "LISTEN", LocalPort: 443},
+			},
+			map[string]uint64{"443": 0, "8080": 7},
+		},
+		{
+			"lowest ports, others summed",
+			manyPorts,
+			manyWant,
+		},
+	}
+	for _, tc := range tests {
+		if diff := cmp.Diff(listenQueues(tc.sockets), tc.want); diff != "" {
+			t.Errorf("%s: listen queues differ: (-got +want)\n%s", tc.name, diff)
+		}
+	}
+}
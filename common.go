@@ -13,6 +13,23 @@ type (
 		Username  string
 		PID       int
 		StartTime time.Time
+		// TTY is the name of the controlling terminal, e.g. "pts/3", or
+		// "" if there is none.
+		TTY     string
+		Session int
+		PGRP    int
+		// LoginUser is the name of the user who logged in to start the
+		// process's session, and SessionID the session's id; they're ""
+		// and -1 if the process isn't part of a login session.
+		LoginUser string
+		SessionID int
+		// SecurityContext is the SELinux context or AppArmor label of the
+		// process, or "" if it has none.
+		SecurityContext string
+		// ListenPorts returns the sorted TCP and UDP ports the process
+		// listens on.  Finding them is expensive, so it's only called when
+		// needed; it may be nil, in which case there are none.
+		ListenPorts func() []int
 	}
 
 	MatchNamer interface {
@@ -21,4 +38,76 @@ type (
 		MatchAndName(ProcAttributes) (bool, string)
 		fmt.Stringer
 	}
+
+	// RuleMatchNamer is a MatchNamer made of rules that may carry settings
+	// beyond the group name, such as metadata or how to handle children.
+	RuleMatchNamer interface {
+		MatchNamer
+		// MatchAndNameRule is like MatchAndName, but also returns the rule
+		// that matched, or nil if none did.
+		MatchAndNameRule(ProcAttributes) (bool, string, Rule)
+		// MetadataKeys returns the sorted union of metadata keys of all rules.
+		MetadataKeys() []string
+		// ExcludeChild returns true if child, an otherwise unmatched
+		// descendant of a tracked process, must not be tracked through
+		// its ancestry, nor must its own descendants.
+		ExcludeChild(child ProcAttributes) bool
+		// HasAgeRules returns true if some rule selects processes by age.
+		HasAgeRules() bool
+		// AgeThresholds returns the sorted ages of nacl at which the result
+		// of matching it may change, because some rule whose other
+		// selectors match it selects processes by age.
+		AgeThresholds(nacl ProcAttributes) []time.Duration
+		// RefreshPidfiles rereads the pidfiles some rules select processes
+		// by, returning the PIDs they now hold.
+		RefreshPidfiles() []int
+		// HasPortRules returns true if some rule selects processes by the
+		// ports they listen on, which a process may only do some time
+		// after it started.
+		HasPortRules() bool
+		// HasUsageRules returns true if some rule selects processes by
+		// resource usage, see MatchAndNameUsage.
+		HasUsageRules() bool
+		// MatchAndNameUsage is like MatchAndNameRule, but only considers the
+		// rules that select processes by resource usage.  held is the rule
+		// that matched the process on the previous cycle, if any: to avoid
+		// flapping, a process stops matching it only once its usage has
+		// dropped well below the rule's thresholds.
+		MatchAndNameUsage(nacl ProcAttributes, usage Usage, held Rule) (bool, string, Rule)
+	}
+
+	// Usage describes the recent resource usage of a process.
+	Usage struct {
+		// ResidentBytes is the current resident memory size.
+		ResidentBytes uint64
+		// CPURatio is the CPU time used per second of elapsed time,
+		// i.e. 1 means a full CPU.
+		CPURatio float64
+	}
+
+	// Rule is a single rule of a RuleMatchNamer.
+	Rule interface {
+		// Metadata returns the metadata of the groups named by the rule,
+		// which may be nil.
+		Metadata() map[string]string
+		// ChildGroup says how to track child, an otherwise unmatched
+		// descendant of a process the rule named parentGroup.  If the
+		// mode is ChildSeparate, the child's group name is also returned.
+		ChildGroup(parentGroup string, child ProcAttributes) (ChildMode, string)
+	}
+
+	// ChildMode says how the unmatched descendants of a tracked process
+	// are tracked.
+	ChildMode int
+)
+
+const (
+	// ChildDefault leaves the decision to the -children flag.
+	ChildDefault ChildMode = iota
+	// ChildInherit tracks descendants as part of their ancestor's group.
+	ChildInherit
+	// ChildSeparate tracks descendants in a group of their own.
+	ChildSeparate
+	// ChildIgnore doesn't track descendants.
+	ChildIgnore
 )
@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
@@ -22,7 +25,10 @@ type (
 	}
 
 	FirstMatcher struct {
-		matchers []common.MatchNamer
+		matchers []*matchNamer
+		// childExclude selects children that are never added to their
+		// parent's group.
+		childExclude []andMatcher
 	}
 
 	commMatcher struct {
@@ -38,6 +44,59 @@ type (
 		captures map[string]string
 	}
 
+	// loginUserMatcher matches procs whose session was started by a login
+	// of any of its users.
+	loginUserMatcher struct {
+		users map[string]struct{}
+	}
+
+	// ttyMatcher matches procs whose controlling terminal name matches
+	// any of its regexes.
+	ttyMatcher struct {
+		regexes []*regexp.Regexp
+	}
+
+	// securityContextMatcher matches procs whose security context matches
+	// any of its regexes.
+	securityContextMatcher struct {
+		regexes []*regexp.Regexp
+	}
+
+	// interactiveMatcher matches procs that are part of a login session,
+	// or those that aren't if interactive is false.
+	interactiveMatcher struct {
+		interactive bool
+	}
+
+	// listeningPortMatcher matches procs listening on any of its ports.
+	listeningPortMatcher struct {
+		ports map[int]struct{}
+	}
+
+	// pidfileMatcher matches procs whose PID is held by any of its
+	// pidfiles, as of the last refresh.  pids maps each such PID to the
+	// modification time of its pidfile.
+	pidfileMatcher struct {
+		paths []string
+		pids  map[int]time.Time
+	}
+
+	// ageMatcher matches procs at least min and less than max old; a zero
+	// bound is ignored.
+	ageMatcher struct {
+		min time.Duration
+		max time.Duration
+	}
+
+	// usageMatcher matches procs whose resource usage reaches any of its
+	// nonzero thresholds.  A proc it already matched keeps matching until
+	// its usage drops below release times the thresholds.
+	usageMatcher struct {
+		minResident uint64
+		minCPU      float64
+		release     float64
+	}
+
 	andMatcher []Matcher
 
 	templateNamer struct {
@@ -47,17 +106,34 @@ type (
 	matchNamer struct {
 		andMatcher
 		templateNamer
+		metadata map[string]string
+		// usage is non-nil for rules that select procs by resource usage.
+		usage    *usageMatcher
+		children common.ChildMode
+		// childNamer names children when children is ChildSeparate.
+		childNamer *templateNamer
 	}
 
 	templateParams struct {
-		Cgroups   []string
-		Comm      string
-		ExeBase   string
-		ExeFull   string
-		Username  string
-		PID       int
-		StartTime time.Time
-		Matches   map[string]string
+		// ParentGroup is only set when naming children of a tracked process.
+		ParentGroup     string
+		Cgroups         []string
+		Comm            string
+		ExeBase         string
+		ExeFull         string
+		Username        string
+		PID             int
+		StartTime       time.Time
+		Matches         map[string]string
+		TTY             string
+		Session         int
+		PGRP            int
+		LoginUser       string
+		SessionID       int
+		SecurityContext string
+		// listenPorts backs the ListenPorts method, so that ports are only
+		// looked up for names that use them.
+		listenPorts func() []int
 	}
 )
 
@@ -69,6 +145,47 @@ func (e *exeMatcher) String() string {
 	return fmt.Sprintf("exes: %+v", e.exes)
 }
 
+func (l *loginUserMatcher) String() string {
+	var users = make([]string, 0, len(l.users))
+	for u := range l.users {
+		users = append(users, u)
+	}
+	return fmt.Sprintf("login users: %+v", users)
+}
+
+func (t *ttyMatcher) String() string {
+	return fmt.Sprintf("ttys: %+v", t.regexes)
+}
+
+func (s *securityContextMatcher) String() string {
+	return fmt.Sprintf("security contexts: %+v", s.regexes)
+}
+
+func (i *interactiveMatcher) String() string {
+	return fmt.Sprintf("interactive: %v", i.interactive)
+}
+
+func (l *listeningPortMatcher) String() string {
+	var ports = make([]int, 0, len(l.ports))
+	for p := range l.ports {
+		ports = append(ports, p)
+	}
+	sort.Ints(ports)
+	return fmt.Sprintf("listening ports: %+v", ports)
+}
+
+func (p *pidfileMatcher) String() string {
+	return fmt.Sprintf("pidfiles: %+v", p.paths)
+}
+
+func (a *ageMatcher) String() string {
+	return fmt.Sprintf("age: [%v, %v)", a.min, a.max)
+}
+
+func (u *usageMatcher) String() string {
+	return fmt.Sprintf("usage: resident>=%d or cpu>=%v", u.minResident, u.minCPU)
+}
+
 func (c *commMatcher) String() string {
 	var comms = make([]string, 0, len(c.comms))
 	for cm := range c.comms {
@@ -90,15 +207,163 @@ func (f FirstMatcher) MatchAndName(nacl common.ProcAttributes) (bool, string) {
 	return false, ""
 }
 
+// MatchAndNameRule implements common.RuleMatchNamer.
+func (f FirstMatcher) MatchAndNameRule(nacl common.ProcAttributes) (bool, string, common.Rule) {
+	for _, m := range f.matchers {
+		if matched, name := m.MatchAndName(nacl); matched {
+			return true, name, m
+		}
+	}
+	return false, "", nil
+}
+
+// HasUsageRules implements common.RuleMatchNamer.
+func (f FirstMatcher) HasUsageRules() bool {
+	for _, m := range f.matchers {
+		if m.usage != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPortRules implements common.RuleMatchNamer.
+func (f FirstMatcher) HasPortRules() bool {
+	for _, m := range f.matchers {
+		for _, am := range m.andMatcher {
+			if _, ok := am.(*listeningPortMatcher); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MatchAndNameUsage implements common.RuleMatchNamer.
+func (f FirstMatcher) MatchAndNameUsage(nacl common.ProcAttributes, usage common.Usage, held common.Rule) (bool, string, common.Rule) {
+	for _, m := range f.matchers {
+		if m.usage == nil || !m.usage.match(usage, held == common.Rule(m)) || !m.Match(nacl) {
+			continue
+		}
+		return true, m.name(nacl), m
+	}
+	return false, "", nil
+}
+
+// ExcludeChild implements common.RuleMatchNamer.
+func (f FirstMatcher) ExcludeChild(nacl common.ProcAttributes) bool {
+	for _, m := range f.childExclude {
+		if m.Match(nacl) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAgeRules implements common.RuleMatchNamer.
+func (f FirstMatcher) HasAgeRules() bool {
+	for _, m := range f.matchers {
+		if m.ageSelector() != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// AgeThresholds implements common.RuleMatchNamer.  Ports aren't looked up:
+// rules that select by listening port count as matching.
+func (f FirstMatcher) AgeThresholds(nacl common.ProcAttributes) []time.Duration {
+	var ths []time.Duration
+	for _, m := range f.matchers {
+		a := m.ageSelector()
+		if a == nil || !m.matchBesidesAge(nacl) {
+			continue
+		}
+		for _, th := range []time.Duration{a.min, a.max} {
+			if th != 0 {
+				ths = append(ths, th)
+			}
+		}
+	}
+	sort.Slice(ths, func(i, j int) bool { return ths[i] < ths[j] })
+	return ths
+}
+
+// ageSelector returns the age selector of m, or nil if it has none.
+func (m *matchNamer) ageSelector() *ageMatcher {
+	for _, am := range m.andMatcher {
+		if a, ok := am.(*ageMatcher); ok {
+			return a
+		}
+	}
+	return nil
+}
+
+// matchBesidesAge returns true if the selectors of m other than the age
+// and listening port ones match nacl.
+func (m *matchNamer) matchBesidesAge(nacl common.ProcAttributes) bool {
+	for _, am := range m.andMatcher {
+		switch am.(type) {
+		case *ageMatcher, *listeningPortMatcher:
+			continue
+		}
+		if !am.Match(nacl) {
+			return false
+		}
+	}
+	return true
+}
+
+// RefreshPidfiles implements common.RuleMatchNamer.
+func (f FirstMatcher) RefreshPidfiles() []int {
+	var pids []int
+	refresh := func(am andMatcher) {
+		for _, m := range am {
+			if p, ok := m.(*pidfileMatcher); ok {
+				pids = append(pids, p.refresh()...)
+			}
+		}
+	}
+	for _, m := range f.matchers {
+		refresh(m.andMatcher)
+	}
+	for _, am := range f.childExclude {
+		refresh(am)
+	}
+	return pids
+}
+
+// MetadataKeys implements common.RuleMatchNamer.
+func (f FirstMatcher) MetadataKeys() []string {
+	seen := make(map[string]struct{})
+	var keys []string
+	for _, m := range f.matchers {
+		for k := range m.metadata {
+			if _, ok := seen[k]; !ok {
+				seen[k] = struct{}{}
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func (m *matchNamer) String() string {
 	return fmt.Sprintf("%+v", m.andMatcher)
 }
 
+// MatchAndName never matches rules that select procs by resource usage,
+// see FirstMatcher.MatchAndNameUsage.
 func (m *matchNamer) MatchAndName(nacl common.ProcAttributes) (bool, string) {
-	if !m.Match(nacl) {
+	if m.usage != nil || !m.Match(nacl) {
 		return false, ""
 	}
+	return true, m.name(nacl)
+}
 
+// name executes the name template for nacl, which must have matched.
+func (m *matchNamer) name(nacl common.ProcAttributes) string {
 	matches := make(map[string]string)
 	for _, m := range m.andMatcher {
 		if mc, ok := m.(*cmdlineMatcher); ok {
@@ -108,24 +373,65 @@ func (m *matchNamer) MatchAndName(nacl common.ProcAttributes) (bool, string) {
 		}
 	}
 
+	var buf bytes.Buffer
+	m.template.Execute(&buf, newTemplateParams(nacl, matches))
+	return buf.String()
+}
+
+// Metadata implements common.Rule.
+func (m *matchNamer) Metadata() map[string]string {
+	return m.metadata
+}
+
+// ChildGroup implements common.Rule.
+func (m *matchNamer) ChildGroup(parentGroup string, child common.ProcAttributes) (common.ChildMode, string) {
+	if m.children != common.ChildSeparate {
+		return m.children, ""
+	}
+
+	params := newTemplateParams(child, map[string]string{})
+	params.ParentGroup = parentGroup
+	var buf bytes.Buffer
+	m.childNamer.template.Execute(&buf, params)
+	return m.children, buf.String()
+}
+
+func newTemplateParams(nacl common.ProcAttributes, matches map[string]string) *templateParams {
 	exebase, exefull := nacl.Name, nacl.Name
 	if len(nacl.Cmdline) > 0 {
 		exefull = nacl.Cmdline[0]
 		exebase = filepath.Base(exefull)
 	}
 
-	var buf bytes.Buffer
-	m.template.Execute(&buf, &templateParams{
-		Comm:      nacl.Name,
-		Cgroups:   nacl.Cgroups,
-		ExeBase:   exebase,
-		ExeFull:   exefull,
-		Matches:   matches,
-		Username:  nacl.Username,
-		PID:       nacl.PID,
-		StartTime: nacl.StartTime,
-	})
-	return true, buf.String()
+	return &templateParams{
+		Comm:            nacl.Name,
+		Cgroups:         nacl.Cgroups,
+		ExeBase:         exebase,
+		ExeFull:         exefull,
+		Matches:         matches,
+		Username:        nacl.Username,
+		PID:             nacl.PID,
+		StartTime:       nacl.StartTime,
+		TTY:             nacl.TTY,
+		Session:         nacl.Session,
+		PGRP:            nacl.PGRP,
+		LoginUser:       nacl.LoginUser,
+		SessionID:       nacl.SessionID,
+		SecurityContext: nacl.SecurityContext,
+		listenPorts:     nacl.ListenPorts,
+	}
+}
+
+// ListenPorts returns the comma-separated ports the proc listens on.
+func (p *templateParams) ListenPorts() string {
+	if p.listenPorts == nil {
+		return ""
+	}
+	var ports []string
+	for _, port := range p.listenPorts() {
+		ports = append(ports, strconv.Itoa(port))
+	}
+	return strings.Join(ports, ",")
 }
 
 func (m *commMatcher) Match(nacl common.ProcAttributes) bool {
@@ -167,6 +473,118 @@ func (m *cmdlineMatcher) Match(nacl common.ProcAttributes) bool {
 	return true
 }
 
+func (m *loginUserMatcher) Match(nacl common.ProcAttributes) bool {
+	if nacl.LoginUser == "" {
+		return false
+	}
+	_, found := m.users[nacl.LoginUser]
+	return found
+}
+
+func (m *ttyMatcher) Match(nacl common.ProcAttributes) bool {
+	if nacl.TTY == "" {
+		return false
+	}
+	for _, regex := range m.regexes {
+		if regex.MatchString(nacl.TTY) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *securityContextMatcher) Match(nacl common.ProcAttributes) bool {
+	if nacl.SecurityContext == "" {
+		return false
+	}
+	for _, regex := range m.regexes {
+		if regex.MatchString(nacl.SecurityContext) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *interactiveMatcher) Match(nacl common.ProcAttributes) bool {
+	return (nacl.LoginUser != "") == m.interactive
+}
+
+func (m *listeningPortMatcher) Match(nacl common.ProcAttributes) bool {
+	if nacl.ListenPorts == nil {
+		return false
+	}
+	for _, port := range nacl.ListenPorts() {
+		if _, found := m.ports[port]; found {
+			return true
+		}
+	}
+	return false
+}
+
+// pidfileSlack is how much later than its pidfile was written a proc may
+// appear to have started, given that start times are only approximate.
+const pidfileSlack = 2 * time.Second
+
+func (m *pidfileMatcher) Match(nacl common.ProcAttributes) bool {
+	if m.pids == nil {
+		m.refresh()
+	}
+	written, ok := m.pids[nacl.PID]
+	// A proc that started after its PID was written to the pidfile
+	// reused the PID of a process that's gone, leaving the pidfile stale.
+	return ok && !nacl.StartTime.After(written.Add(pidfileSlack))
+}
+
+// refresh rereads the pidfiles, ignoring those that are missing or don't
+// hold a PID, and returns the PIDs they hold.
+func (m *pidfileMatcher) refresh() []int {
+	m.pids = make(map[int]time.Time)
+	var pids []int
+	for _, path := range m.paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		fields := strings.Fields(string(buf))
+		if len(fields) == 0 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil || pid <= 0 {
+			continue
+		}
+		m.pids[pid] = fi.ModTime()
+		pids = append(pids, pid)
+	}
+	return pids
+}
+
+func (m *ageMatcher) Match(nacl common.ProcAttributes) bool {
+	age := time.Since(nacl.StartTime)
+	if m.min != 0 && age < m.min {
+		return false
+	}
+	if m.max != 0 && age >= m.max {
+		return false
+	}
+	return true
+}
+
+func (m *usageMatcher) match(usage common.Usage, held bool) bool {
+	scale := 1.0
+	if held {
+		scale = m.release
+	}
+	if m.minResident != 0 && float64(usage.ResidentBytes) >= scale*float64(m.minResident) {
+		return true
+	}
+	return m.minCPU != 0 && usage.CPURatio >= scale*m.minCPU
+}
+
 func (m andMatcher) Match(nacl common.ProcAttributes) bool {
 	for _, matcher := range m {
 		if !matcher.Match(nacl) {
@@ -183,7 +601,8 @@ type Config struct {
 func (c *Config) UnmarshalYAML(unmarshal func(v interface{}) error) error {
 	type (
 		root struct {
-			Matchers MatcherRules `yaml:"process_names"`
+			Matchers     MatcherRules `yaml:"process_names"`
+			ChildExclude MatcherRules `yaml:"child_exclude"`
 		}
 	)
 
@@ -196,59 +615,205 @@ func (c *Config) UnmarshalYAML(unmarshal func(v interface{}) error) error {
 	if err != nil {
 		return err
 	}
+	for _, g := range r.ChildExclude {
+		if g.selectsUsage() {
+			return fmt.Errorf("bad child_exclude: resource usage selectors not supported")
+		}
+		matchers, err := g.selectors()
+		if err != nil {
+			return fmt.Errorf("bad child_exclude: %v", err)
+		}
+		cfg.MatchNamers.childExclude = append(cfg.MatchNamers.childExclude, matchers)
+	}
 	*c = *cfg
 	return nil
 }
 
+// metadataKeyRE matches the keys allowed in MatcherGroup.Metadata, which
+// must be valid Prometheus label names.  Names starting with "__" are
+// reserved by Prometheus and rejected separately.
+var metadataKeyRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
 type MatcherGroup struct {
 	Name         string   `yaml:"name"`
 	CommRules    []string `yaml:"comm"`
 	ExeRules     []string `yaml:"exe"`
 	CmdlineRules []string `yaml:"cmdline"`
+	// MinAge and MaxAge select procs by how long ago they started.
+	MinAge time.Duration `yaml:"min_age"`
+	MaxAge time.Duration `yaml:"max_age"`
+	// LoginUserRules, TTYRules and Interactive select procs by the login
+	// session they belong to.
+	LoginUserRules []string `yaml:"login_user"`
+	TTYRules       []string `yaml:"tty"`
+	Interactive    *bool    `yaml:"interactive"`
+	// SecurityContextRules select procs by their SELinux context or
+	// AppArmor label.
+	SecurityContextRules []string `yaml:"security_context"`
+	// PidfileRules select the procs whose PID is held by any of the files.
+	PidfileRules []string `yaml:"pidfile"`
+	// ListeningPortRules select the procs listening on any of the TCP or
+	// UDP ports.
+	ListeningPortRules []int `yaml:"listening_port"`
+	// MinResidentBytes and MinCPURatio select procs whose resident memory or
+	// CPU usage reaches either threshold.  Such procs remain selected until
+	// their usage drops below ReleaseRatio times the thresholds.
+	MinResidentBytes uint64  `yaml:"min_resident_bytes"`
+	MinCPURatio      float64 `yaml:"min_cpu_ratio"`
+	ReleaseRatio     float64 `yaml:"release_ratio"`
+	// Metadata is exported as labels of namedprocess_namegroup_info.
+	Metadata map[string]string `yaml:"metadata"`
+	// Children is one of inherit, separate or ignore; if empty, the
+	// -children flag decides.
+	Children string `yaml:"children"`
+	// ChildName is the name template for children when Children is separate.
+	ChildName string `yaml:"child_name"`
 }
 
 type MatcherRules []MatcherGroup
 
-func (r MatcherRules) ToConfig() (*Config, error) {
-	var cfg Config
-
-	for _, matcher := range r {
-		var matchers andMatcher
+// selectors returns the matchers for the selectors of g.
+func (g MatcherGroup) selectors() (andMatcher, error) {
+	var matchers andMatcher
 
-		if matcher.CommRules != nil {
-			comms := make(map[string]struct{})
-			for _, c := range matcher.CommRules {
-				comms[c] = struct{}{}
+	if g.CommRules != nil {
+		comms := make(map[string]struct{})
+		for _, c := range g.CommRules {
+			comms[c] = struct{}{}
+		}
+		matchers = append(matchers, &commMatcher{comms})
+	}
+	if g.ExeRules != nil {
+		exes := make(map[string]string)
+		for _, e := range g.ExeRules {
+			if strings.Contains(e, "/") {
+				exes[filepath.Base(e)] = e
+			} else {
+				exes[e] = ""
+			}
+		}
+		matchers = append(matchers, &exeMatcher{exes})
+	}
+	if g.CmdlineRules != nil {
+		var rs []*regexp.Regexp
+		for _, c := range g.CmdlineRules {
+			r, err := regexp.Compile(c)
+			if err != nil {
+				return nil, fmt.Errorf("bad cmdline regex %q: %v", c, err)
 			}
-			matchers = append(matchers, &commMatcher{comms})
-		}
-		if matcher.ExeRules != nil {
-			exes := make(map[string]string)
-			for _, e := range matcher.ExeRules {
-				if strings.Contains(e, "/") {
-					exes[filepath.Base(e)] = e
-				} else {
-					exes[e] = ""
-				}
+			rs = append(rs, r)
+		}
+		matchers = append(matchers, &cmdlineMatcher{
+			regexes:  rs,
+			captures: make(map[string]string),
+		})
+	}
+	if g.LoginUserRules != nil {
+		users := make(map[string]struct{})
+		for _, u := range g.LoginUserRules {
+			users[u] = struct{}{}
+		}
+		matchers = append(matchers, &loginUserMatcher{users})
+	}
+	if g.TTYRules != nil {
+		var rs []*regexp.Regexp
+		for _, t := range g.TTYRules {
+			r, err := regexp.Compile("^(?:" + t + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("bad tty regex %q: %v", t, err)
 			}
-			matchers = append(matchers, &exeMatcher{exes})
-		}
-		if matcher.CmdlineRules != nil {
-			var rs []*regexp.Regexp
-			for _, c := range matcher.CmdlineRules {
-				r, err := regexp.Compile(c)
-				if err != nil {
-					return nil, fmt.Errorf("bad cmdline regex %q: %v", c, err)
-				}
-				rs = append(rs, r)
+			rs = append(rs, r)
+		}
+		matchers = append(matchers, &ttyMatcher{rs})
+	}
+	if g.SecurityContextRules != nil {
+		var rs []*regexp.Regexp
+		for _, sc := range g.SecurityContextRules {
+			r, err := regexp.Compile("^(?:" + sc + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("bad security_context regex %q: %v", sc, err)
 			}
-			matchers = append(matchers, &cmdlineMatcher{
-				regexes:  rs,
-				captures: make(map[string]string),
-			})
+			rs = append(rs, r)
+		}
+		matchers = append(matchers, &securityContextMatcher{rs})
+	}
+	if g.Interactive != nil {
+		matchers = append(matchers, &interactiveMatcher{*g.Interactive})
+	}
+	if g.PidfileRules != nil {
+		matchers = append(matchers, &pidfileMatcher{paths: g.PidfileRules})
+	}
+	if g.MinAge != 0 || g.MaxAge != 0 {
+		if g.MinAge < 0 || g.MaxAge < 0 || (g.MaxAge != 0 && g.MinAge >= g.MaxAge) {
+			return nil, fmt.Errorf("bad age range: min_age %v, max_age %v", g.MinAge, g.MaxAge)
+		}
+		matchers = append(matchers, &ageMatcher{g.MinAge, g.MaxAge})
+	}
+	// Finding the ports a proc listens on is expensive, so it comes last
+	// to only be done for procs that the other selectors match.
+	if g.ListeningPortRules != nil {
+		ports := make(map[int]struct{})
+		for _, port := range g.ListeningPortRules {
+			if port <= 0 || port > 65535 {
+				return nil, fmt.Errorf("bad listening_port %d", port)
+			}
+			ports[port] = struct{}{}
+		}
+		matchers = append(matchers, &listeningPortMatcher{ports})
+	}
+	if len(matchers) == 0 && !g.selectsUsage() {
+		return nil, fmt.Errorf("no matchers provided")
+	}
+	return matchers, nil
+}
+
+func (g MatcherGroup) selectsUsage() bool {
+	return g.MinResidentBytes != 0 || g.MinCPURatio != 0
+}
+
+// usageSelector returns the usageMatcher for g, or nil if g doesn't select
+// by resource usage.
+func (g MatcherGroup) usageSelector() (*usageMatcher, error) {
+	if !g.selectsUsage() {
+		if g.ReleaseRatio != 0 {
+			return nil, fmt.Errorf("release_ratio given without min_resident_bytes or min_cpu_ratio")
+		}
+		return nil, nil
+	}
+	if g.MinCPURatio < 0 {
+		return nil, fmt.Errorf("bad min_cpu_ratio %v", g.MinCPURatio)
+	}
+	release := g.ReleaseRatio
+	if release == 0 {
+		release = 0.8
+	}
+	if release < 0 || release > 1 {
+		return nil, fmt.Errorf("bad release_ratio %v, must be between 0 and 1", release)
+	}
+	return &usageMatcher{g.MinResidentBytes, g.MinCPURatio, release}, nil
+}
+
+func (r MatcherRules) ToConfig() (*Config, error) {
+	var cfg Config
+	// metadataByName holds the metadata of the groups whose name isn't a
+	// template, so that a group can't get different metadata from
+	// different rules.
+	metadataByName := make(map[string]map[string]string)
+	checkMetadata := func(name string, metadata map[string]string) error {
+		if strings.Contains(name, "{{") {
+			return nil
 		}
-		if len(matchers) == 0 {
-			return nil, fmt.Errorf("no matchers provided")
+		if prev, ok := metadataByName[name]; ok && !sameMetadata(prev, metadata) {
+			return fmt.Errorf("conflicting metadata for group %q", name)
+		}
+		metadataByName[name] = metadata
+		return nil
+	}
+
+	for _, matcher := range r {
+		matchers, err := matcher.selectors()
+		if err != nil {
+			return nil, err
 		}
 
 		nametmpl := matcher.Name
@@ -256,18 +821,82 @@ func (r MatcherRules) ToConfig() (*Config, error) {
 			nametmpl = "{{.ExeBase}}"
 		}
 		tmpl := template.New("cmdname")
-		tmpl, err := tmpl.Parse(nametmpl)
+		tmpl, err = tmpl.Parse(nametmpl)
 		if err != nil {
 			return nil, fmt.Errorf("bad name template %q: %v", nametmpl, err)
 		}
 
-		matchNamer := &matchNamer{matchers, templateNamer{tmpl}}
+		for k := range matcher.Metadata {
+			if !metadataKeyRE.MatchString(k) || strings.HasPrefix(k, "__") || k == "groupname" {
+				return nil, fmt.Errorf("bad metadata key %q", k)
+			}
+		}
+		if err := checkMetadata(nametmpl, matcher.Metadata); err != nil {
+			return nil, err
+		}
+
+		usage, err := matcher.usageSelector()
+		if err != nil {
+			return nil, err
+		}
+
+		matchNamer := &matchNamer{
+			andMatcher:    matchers,
+			templateNamer: templateNamer{tmpl},
+			metadata:      matcher.Metadata,
+			usage:         usage,
+		}
+
+		switch matcher.Children {
+		case "":
+		case "inherit":
+			matchNamer.children = common.ChildInherit
+		case "separate":
+			matchNamer.children = common.ChildSeparate
+		case "ignore":
+			matchNamer.children = common.ChildIgnore
+		default:
+			return nil, fmt.Errorf("bad children value %q, must be one of inherit, separate or ignore", matcher.Children)
+		}
+
+		if matcher.ChildName != "" && matchNamer.children != common.ChildSeparate {
+			return nil, fmt.Errorf("child_name %q given without children: separate", matcher.ChildName)
+		}
+		if matchNamer.children == common.ChildSeparate {
+			childtmpl := matcher.ChildName
+			if childtmpl == "" {
+				childtmpl = "{{.ParentGroup}}/{{.Comm}}"
+			}
+			tmpl, err := template.New("childname").Parse(childtmpl)
+			if err != nil {
+				return nil, fmt.Errorf("bad child_name template %q: %v", childtmpl, err)
+			}
+			matchNamer.childNamer = &templateNamer{tmpl}
+			// Separated children keep the metadata of their parent's rule.
+			if err := checkMetadata(childtmpl, matcher.Metadata); err != nil {
+				return nil, err
+			}
+		}
+
 		cfg.MatchNamers.matchers = append(cfg.MatchNamers.matchers, matchNamer)
 	}
 
 	return &cfg, nil
 }
 
+// sameMetadata returns true if a and b hold the same keys and values.
+func sameMetadata(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
 // ReadRecipesFile opens the named file and extracts recipes from it.
 func ReadFile(cfgpath string, debug bool) (*Config, error) {
 	content, err := ioutil.ReadFile(cfgpath)
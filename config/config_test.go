@@ -2,9 +2,12 @@ package config
 
 import (
 	// "github.com/kylelemons/godebug/pretty"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
 	common "github.com/ncabatoff/process-exporter"
 	. "gopkg.in/check.v1"
-	"time"
 )
 
 func (s MySuite) TestConfigBasic(c *C) {
@@ -93,3 +96,362 @@ process_names:
 	c.Check(found, Equals, true)
 	c.Check(name, Equals, now.String())
 }
+
+func (s MySuite) TestConfigMetadata(c *C) {
+	yml := `
+process_names:
+  - comm:
+    - postgres
+    metadata:
+      owner: dba
+      runbook: https://wiki/pg
+  - comm:
+    - nginx
+    metadata:
+      team: web
+  - comm:
+    - bash
+`
+	cfg, err := GetConfig(yml, false)
+	c.Assert(err, IsNil)
+	c.Check(cfg.MatchNamers.MetadataKeys(), DeepEquals, []string{"owner", "runbook", "team"})
+
+	found, name, rule := cfg.MatchNamers.MatchAndNameRule(common.ProcAttributes{Name: "postgres"})
+	c.Check(found, Equals, true)
+	c.Check(name, Equals, "postgres")
+	c.Check(rule.Metadata(), DeepEquals, map[string]string{"owner": "dba", "runbook": "https://wiki/pg"})
+
+	found, _, rule = cfg.MatchNamers.MatchAndNameRule(common.ProcAttributes{Name: "bash"})
+	c.Check(found, Equals, true)
+	c.Check(rule.Metadata(), IsNil)
+
+	_, err = GetConfig(`
+process_names:
+  - comm:
+    - bash
+    metadata:
+      groupname: oops
+`, false)
+	c.Check(err, NotNil)
+
+	_, err = GetConfig(`
+process_names:
+  - comm:
+    - bash
+    metadata:
+      __reserved: oops
+`, false)
+	c.Check(err, NotNil)
+
+	// A group gets its metadata from a single rule, or rules that agree.
+	_, err = GetConfig(`
+process_names:
+  - name: shells
+    comm:
+    - bash
+    metadata:
+      team: a
+  - name: shells
+    comm:
+    - zsh
+    metadata:
+      team: b
+`, false)
+	c.Check(err, NotNil)
+
+	_, err = GetConfig(`
+process_names:
+  - name: shells
+    comm:
+    - bash
+    metadata:
+      team: a
+  - name: shells
+    comm:
+    - zsh
+    metadata:
+      team: a
+  - name: "{{.Comm}}"
+    comm:
+    - fish
+    metadata:
+      team: b
+`, false)
+	c.Check(err, IsNil)
+}
+
+func (s MySuite) TestConfigChildren(c *C) {
+	yml := `
+process_names:
+  - comm:
+    - gitlab-runner
+    name: ci-runner
+    children: separate
+  - comm:
+    - make
+    children: separate
+    child_name: "{{.ParentGroup}}:{{.ExeBase}}"
+  - comm:
+    - sshd
+    children: ignore
+  - comm:
+    - bash
+`
+	cfg, err := GetConfig(yml, false)
+	c.Assert(err, IsNil)
+
+	gcc := common.ProcAttributes{Name: "gcc", Cmdline: []string{"/usr/bin/gcc", "-c", "x.c"}}
+
+	_, name, rule := cfg.MatchNamers.MatchAndNameRule(common.ProcAttributes{Name: "gitlab-runner"})
+	mode, cname := rule.ChildGroup(name, gcc)
+	c.Check(mode, Equals, common.ChildSeparate)
+	c.Check(cname, Equals, "ci-runner/gcc")
+
+	_, name, rule = cfg.MatchNamers.MatchAndNameRule(common.ProcAttributes{Name: "make"})
+	mode, cname = rule.ChildGroup(name, gcc)
+	c.Check(mode, Equals, common.ChildSeparate)
+	c.Check(cname, Equals, "make:gcc")
+
+	_, name, rule = cfg.MatchNamers.MatchAndNameRule(common.ProcAttributes{Name: "sshd"})
+	mode, _ = rule.ChildGroup(name, gcc)
+	c.Check(mode, Equals, common.ChildIgnore)
+
+	_, name, rule = cfg.MatchNamers.MatchAndNameRule(common.ProcAttributes{Name: "bash"})
+	mode, _ = rule.ChildGroup(name, gcc)
+	c.Check(mode, Equals, common.ChildDefault)
+
+	_, err = GetConfig(`
+process_names:
+  - comm:
+    - bash
+    children: adopt
+`, false)
+	c.Check(err, NotNil)
+}
+
+func (s MySuite) TestConfigChildExclude(c *C) {
+	yml := `
+process_names:
+  - comm:
+    - bash
+child_exclude:
+  - comm:
+    - sshd
+  - exe:
+    - /usr/bin/ssh-agent
+`
+	cfg, err := GetConfig(yml, false)
+	c.Assert(err, IsNil)
+
+	c.Check(cfg.MatchNamers.ExcludeChild(common.ProcAttributes{Name: "sshd"}), Equals, true)
+	c.Check(cfg.MatchNamers.ExcludeChild(common.ProcAttributes{
+		Name: "ssh-agent", Cmdline: []string{"/usr/bin/ssh-agent"}}), Equals, true)
+	c.Check(cfg.MatchNamers.ExcludeChild(common.ProcAttributes{
+		Name: "ssh-agent", Cmdline: []string{"/tmp/ssh-agent"}}), Equals, false)
+	c.Check(cfg.MatchNamers.ExcludeChild(common.ProcAttributes{Name: "bash"}), Equals, false)
+}
+
+func (s MySuite) TestConfigAge(c *C) {
+	yml := `
+process_names:
+  - name: long-running
+    comm:
+    - cron
+    min_age: 24h
+  - comm:
+    - cron
+    max_age: 1m
+`
+	cfg, err := GetConfig(yml, false)
+	c.Assert(err, IsNil)
+	c.Check(cfg.MatchNamers.HasAgeRules(), Equals, true)
+	c.Check(cfg.MatchNamers.AgeThresholds(common.ProcAttributes{Name: "cron"}), DeepEquals, []time.Duration{time.Minute, 24 * time.Hour})
+	// Procs that no age rule could match don't need to be matched again.
+	c.Check(cfg.MatchNamers.AgeThresholds(common.ProcAttributes{Name: "bash"}), IsNil)
+
+	now := time.Now()
+	found, name := cfg.MatchNamers.MatchAndName(common.ProcAttributes{Name: "cron", StartTime: now.Add(-25 * time.Hour)})
+	c.Check(found, Equals, true)
+	c.Check(name, Equals, "long-running")
+	found, name = cfg.MatchNamers.MatchAndName(common.ProcAttributes{Name: "cron", StartTime: now})
+	c.Check(found, Equals, true)
+	c.Check(name, Equals, "cron")
+	found, _ = cfg.MatchNamers.MatchAndName(common.ProcAttributes{Name: "cron", StartTime: now.Add(-time.Hour)})
+	c.Check(found, Equals, false)
+
+	_, err = GetConfig(`
+process_names:
+  - comm:
+    - cron
+    min_age: 1h
+    max_age: 1m
+`, false)
+	c.Check(err, NotNil)
+}
+
+func (s MySuite) TestConfigUsage(c *C) {
+	yml := `
+process_names:
+  - comm:
+    - postgres
+  - name: "heavy:{{.Comm}}"
+    min_resident_bytes: 1073741824
+    min_cpu_ratio: 0.5
+`
+	cfg, err := GetConfig(yml, false)
+	c.Assert(err, IsNil)
+	c.Check(cfg.MatchNamers.HasUsageRules(), Equals, true)
+
+	java := common.ProcAttributes{Name: "java"}
+	found, _ := cfg.MatchNamers.MatchAndName(java)
+	c.Check(found, Equals, false)
+
+	found, _, _ = cfg.MatchNamers.MatchAndNameUsage(java, common.Usage{ResidentBytes: 1 << 20, CPURatio: 0.1}, nil)
+	c.Check(found, Equals, false)
+	found, name, rule := cfg.MatchNamers.MatchAndNameUsage(java, common.Usage{CPURatio: 0.6}, nil)
+	c.Check(found, Equals, true)
+	c.Check(name, Equals, "heavy:java")
+
+	// Hysteresis: once matched, usage must drop below 80% of a threshold.
+	found, _, _ = cfg.MatchNamers.MatchAndNameUsage(java, common.Usage{CPURatio: 0.45}, nil)
+	c.Check(found, Equals, false)
+	found, _, _ = cfg.MatchNamers.MatchAndNameUsage(java, common.Usage{CPURatio: 0.45}, rule)
+	c.Check(found, Equals, true)
+	found, _, _ = cfg.MatchNamers.MatchAndNameUsage(java, common.Usage{CPURatio: 0.35}, rule)
+	c.Check(found, Equals, false)
+}
+
+func (s MySuite) TestConfigSession(c *C) {
+	yml := `
+process_names:
+  - name: "{{.LoginUser}}:{{.TTY}}"
+    login_user:
+    - alice
+    - bob
+    tty:
+    - 'pts/.*'
+  - name: daemons
+    interactive: false
+`
+	cfg, err := GetConfig(yml, false)
+	c.Assert(err, IsNil)
+
+	shell := common.ProcAttributes{Name: "bash", TTY: "pts/3", LoginUser: "bob", SessionID: 2}
+	found, name := cfg.MatchNamers.MatchAndName(shell)
+	c.Check(found, Equals, true)
+	c.Check(name, Equals, "bob:pts/3")
+
+	console := common.ProcAttributes{Name: "bash", TTY: "tty1", LoginUser: "bob", SessionID: 2}
+	found, _ = cfg.MatchNamers.MatchAndName(console)
+	c.Check(found, Equals, false)
+
+	daemon := common.ProcAttributes{Name: "sshd", SessionID: -1}
+	found, name = cfg.MatchNamers.MatchAndName(daemon)
+	c.Check(found, Equals, true)
+	c.Check(name, Equals, "daemons")
+
+	_, err = GetConfig(`
+process_names:
+  - tty:
+    - '('
+`, false)
+	c.Check(err, NotNil)
+}
+
+func (s MySuite) TestConfigPidfile(c *C) {
+	pidfile := filepath.Join(c.MkDir(), "nginx.pid")
+	yml := `
+process_names:
+  - name: nginx
+    pidfile:
+    - ` + pidfile + `
+`
+	cfg, err := GetConfig(yml, false)
+	c.Assert(err, IsNil)
+
+	// A missing pidfile matches nothing.
+	master := common.ProcAttributes{Name: "nginx", PID: 42, StartTime: time.Now().Add(-time.Minute)}
+	c.Check(cfg.MatchNamers.RefreshPidfiles(), HasLen, 0)
+	found, _ := cfg.MatchNamers.MatchAndName(master)
+	c.Check(found, Equals, false)
+
+	c.Assert(ioutil.WriteFile(pidfile, []byte("42\n"), 0644), IsNil)
+	c.Check(cfg.MatchNamers.RefreshPidfiles(), DeepEquals, []int{42})
+	found, name := cfg.MatchNamers.MatchAndName(master)
+	c.Check(found, Equals, true)
+	c.Check(name, Equals, "nginx")
+
+	// A proc that started after the pidfile was written reused a stale PID.
+	reused := common.ProcAttributes{Name: "sh", PID: 42, StartTime: time.Now().Add(time.Minute)}
+	found, _ = cfg.MatchNamers.MatchAndName(reused)
+	c.Check(found, Equals, false)
+
+	c.Assert(ioutil.WriteFile(pidfile, []byte("garbage"), 0644), IsNil)
+	c.Check(cfg.MatchNamers.RefreshPidfiles(), HasLen, 0)
+}
+
+func (s MySuite) TestConfigListeningPort(c *C) {
+	yml := `
+process_names:
+  - name: "db:{{.ListenPorts}}"
+    comm:
+    - postgres
+    listening_port:
+    - 5432
+    - 5433
+`
+	cfg, err := GetConfig(yml, false)
+	c.Assert(err, IsNil)
+	c.Check(cfg.MatchNamers.HasPortRules(), Equals, true)
+
+	var scans int
+	listen := func(ports ...int) func() []int {
+		return func() []int {
+			scans++
+			return ports
+		}
+	}
+
+	found, name := cfg.MatchNamers.MatchAndName(common.ProcAttributes{Name: "postgres", ListenPorts: listen(22, 5433)})
+	c.Check(found, Equals, true)
+	c.Check(name, Equals, "db:22,5433")
+
+	found, _ = cfg.MatchNamers.MatchAndName(common.ProcAttributes{Name: "postgres", ListenPorts: listen(22)})
+	c.Check(found, Equals, false)
+	found, _ = cfg.MatchNamers.MatchAndName(common.ProcAttributes{Name: "postgres"})
+	c.Check(found, Equals, false)
+
+	// Ports aren't looked up for procs the cheaper selectors don't match.
+	scans = 0
+	found, _ = cfg.MatchNamers.MatchAndName(common.ProcAttributes{Name: "sshd", ListenPorts: listen(5432)})
+	c.Check(found, Equals, false)
+	c.Check(scans, Equals, 0)
+
+	_, err = GetConfig(`
+process_names:
+  - listening_port:
+    - 70000
+`, false)
+	c.Check(err, NotNil)
+}
+
+func (s MySuite) TestConfigSecurityContext(c *C) {
+	yml := `
+process_names:
+  - name: "{{.SecurityContext}}"
+    security_context:
+    - 'system_u:system_r:(httpd|postgresql)_t:s0'
+`
+	cfg, err := GetConfig(yml, false)
+	c.Assert(err, IsNil)
+
+	httpd := common.ProcAttributes{Name: "httpd", SecurityContext: "system_u:system_r:httpd_t:s0"}
+	found, name := cfg.MatchNamers.MatchAndName(httpd)
+	c.Check(found, Equals, true)
+	c.Check(name, Equals, "system_u:system_r:httpd_t:s0")
+
+	for _, sc := range []string{"", "system_u:system_r:sshd_t:s0", "system_u:system_r:httpd_t:s0-s0:c0.c1023"} {
+		found, _ = cfg.MatchNamers.MatchAndName(common.ProcAttributes{Name: "httpd", SecurityContext: sc})
+		c.Check(found, Equals, false)
+	}
+}
@@ -9,6 +9,8 @@ import (
 
 type msi map[string]int
 
+type mii map[int]int
+
 // procinfo reads the ProcIdInfo for a proc and returns it or a zero value plus
 // an error.
 func procinfo(p Proc) (IDInfo, error) {
@@ -67,7 +69,7 @@ func (n namer) MatchAndName(nacl common.ProcAttributes) (bool, string) {
 
 func newProcIDStatic(pid, ppid int, startTime uint64, name string, cmdline []string) (ID, Static) {
 	return ID{pid, startTime},
-		Static{name, cmdline, []string{}, ppid, time.Unix(int64(startTime), 0).UTC(), 1000}
+		Static{Name: name, Cmdline: cmdline, Cgroups: []string{}, ParentPid: ppid, StartTime: time.Unix(int64(startTime), 0).UTC(), EffectiveUID: 1000, LoginUID: -1, SessionID: -1}
 }
 
 func newProc(pid int, name string, m Metrics) IDInfo {
@@ -100,6 +102,6 @@ func piinfost(pid int, name string, c Counts, m Memory, f Filedesc, t int, s Sta
 	return IDInfo{
 		ID:      id,
 		Static:  static,
-		Metrics: Metrics{c, m, f, uint64(t), s, ""},
+		Metrics: Metrics{Counts: c, Memory: m, Filedesc: f, NumThreads: uint64(t), States: s},
 	}
 }
@@ -13,9 +13,13 @@ type (
 	Grouper struct {
 		// groupAccum records the historical accumulation of a group so that
 		// we can avoid ever decreasing the counts we return.
-		groupAccum        map[string]Counts
-		tracker           *Tracker
-		threadAccum       map[string]map[string]Threads
+		groupAccum  map[string]Counts
+		tracker     *Tracker
+		threadAccum map[string]map[string]Threads
+		// pressureAccum records the PSI accumulated by each group, and
+		// pressureLast the PSI last read from each of its cgroups.
+		pressureAccum     map[string]Pressure
+		pressureLast      map[string]map[string]Pressure
 		debug             bool
 		removeEmptyGroups bool
 	}
@@ -42,6 +46,37 @@ type (
 		WorstFDratio    float64
 		NumThreads      uint64
 		Threads         []Threads
+		// Metadata is the metadata of the rule that named the group.
+		Metadata map[string]string
+		// Limits is the lowest soft limit on each resource among the
+		// group's procs, and WorstLimitRatio the worst (closest to 1)
+		// ratio between usage and limit, for measurable resources.
+		Limits          map[string]uint64
+		WorstLimitRatio map[string]float64
+		// OpenFDsByType counts open fds by type, if gathered.
+		OpenFDsByType map[string]uint64
+		// DeletedFiles holds the size of the deleted files the group's
+		// procs still have open, if gathered.  Files open in several
+		// procs only appear once.
+		DeletedFiles map[FileID]uint64
+		// Sockets holds the TCP and UDP sockets the group's procs have
+		// open by inode, if gathered.  Sockets shared by several procs
+		// only appear once.
+		Sockets map[uint64]Socket
+		// WorstMapCountRatio is the worst ratio of memory maps to
+		// vm.max_map_count amongst the group's procs.
+		WorstMapCountRatio float64
+		// LastCPUs is how many of the group's threads last ran on each
+		// CPU, and MaxCPUsAllowed the most CPUs any proc may run on.
+		LastCPUs       map[int]uint64
+		MaxCPUsAllowed int
+		// SchedPolicies and Nices are how many of the group's threads
+		// have each scheduling policy and nice value.
+		SchedPolicies map[int]uint64
+		Nices         map[int]uint64
+		// Pressure is the PSI of the group's distinct cgroups, if the
+		// source can read it.
+		Pressure Pressure
 	}
 )
 
@@ -54,6 +89,8 @@ func NewGrouper(namer common.MatchNamer, trackChildren, trackThreads, recheck bo
 	g := Grouper{
 		groupAccum:        make(map[string]Counts),
 		threadAccum:       make(map[string]map[string]Threads),
+		pressureAccum:     make(map[string]Pressure),
+		pressureLast:      make(map[string]map[string]Pressure),
 		tracker:           NewTracker(namer, trackChildren, recheck, recheckTimeLimit, debug),
 		debug:             debug,
 		removeEmptyGroups: removeEmptyGroups,
@@ -70,13 +107,88 @@ func groupadd(grp Group, ts Update) Group {
 	grp.Memory.VmSwapBytes += ts.Memory.VmSwapBytes
 	grp.Memory.ProportionalBytes += ts.Memory.ProportionalBytes
 	grp.Memory.ProportionalSwapBytes += ts.Memory.ProportionalSwapBytes
+	grp.Memory.RssAnonBytes += ts.Memory.RssAnonBytes
+	grp.Memory.RssFileBytes += ts.Memory.RssFileBytes
+	grp.Memory.RssShmemBytes += ts.Memory.RssShmemBytes
+	grp.Memory.VmHWMBytes += ts.Memory.VmHWMBytes
+	grp.Memory.VmLckBytes += ts.Memory.VmLckBytes
+	grp.Memory.VmPTEBytes += ts.Memory.VmPTEBytes
+	grp.Memory.HugetlbBytes += ts.Memory.HugetlbBytes
+	grp.Memory.AnonHugePagesBytes += ts.Memory.AnonHugePagesBytes
+	grp.Memory.UniqueBytes += ts.Memory.UniqueBytes
+	grp.Memory.MapCount += ts.Memory.MapCount
+	for node, bytes := range ts.Memory.NUMANodeBytes {
+		if grp.Memory.NUMANodeBytes == nil {
+			grp.Memory.NUMANodeBytes = make(map[int]uint64)
+		}
+		grp.Memory.NUMANodeBytes[node] += bytes
+	}
+	// The limit is system-wide.
+	grp.Memory.MapCountLimit = ts.Memory.MapCountLimit
+	if ts.Memory.MapCountLimit > 0 {
+		mapratio := float64(ts.Memory.MapCount) / float64(ts.Memory.MapCountLimit)
+		if grp.WorstMapCountRatio < mapratio {
+			grp.WorstMapCountRatio = mapratio
+		}
+	}
 	if ts.Filedesc.Open != -1 {
 		grp.OpenFDs += uint64(ts.Filedesc.Open)
 	}
+	for fdType, count := range ts.Filedesc.ByType {
+		if grp.OpenFDsByType == nil {
+			grp.OpenFDsByType = make(map[string]uint64)
+		}
+		grp.OpenFDsByType[fdType] += uint64(count)
+	}
+	for id, size := range ts.Filedesc.Deleted {
+		if grp.DeletedFiles == nil {
+			grp.DeletedFiles = make(map[FileID]uint64)
+		}
+		grp.DeletedFiles[id] = size
+	}
+	for inode, sock := range ts.Filedesc.Sockets {
+		if grp.Sockets == nil {
+			grp.Sockets = make(map[uint64]Socket)
+		}
+		grp.Sockets[inode] = sock
+	}
 	openratio := float64(ts.Filedesc.Open) / float64(ts.Filedesc.Limit)
 	if grp.WorstFDratio < openratio {
 		grp.WorstFDratio = openratio
 	}
+	for res, l := range ts.Limits {
+		if grp.Limits == nil {
+			grp.Limits = make(map[string]uint64)
+			grp.WorstLimitRatio = make(map[string]float64)
+		}
+		if soft, ok := grp.Limits[res]; !ok || l.Soft < soft {
+			grp.Limits[res] = l.Soft
+		}
+		if ratio, ok := l.Ratio(); ok && ratio >= grp.WorstLimitRatio[res] {
+			grp.WorstLimitRatio[res] = ratio
+		}
+	}
+	for cpu, count := range ts.LastCPUs {
+		if grp.LastCPUs == nil {
+			grp.LastCPUs = make(map[int]uint64)
+		}
+		grp.LastCPUs[cpu] += uint64(count)
+	}
+	for policy, count := range ts.SchedPolicies {
+		if grp.SchedPolicies == nil {
+			grp.SchedPolicies = make(map[int]uint64)
+		}
+		grp.SchedPolicies[policy] += uint64(count)
+	}
+	for nice, count := range ts.Nices {
+		if grp.Nices == nil {
+			grp.Nices = make(map[int]uint64)
+		}
+		grp.Nices[nice] += uint64(count)
+	}
+	if grp.MaxCPUsAllowed < ts.CPUsAllowed {
+		grp.MaxCPUsAllowed = ts.CPUsAllowed
+	}
 	grp.NumThreads += ts.NumThreads
 	grp.Counts.Add(ts.Latest)
 	grp.States.Add(ts.States)
@@ -84,6 +196,10 @@ func groupadd(grp Group, ts Update) Group {
 		grp.OldestStartTime = ts.Start
 	}
 
+	if grp.Metadata == nil {
+		grp.Metadata = ts.Metadata
+	}
+
 	if grp.Wchans == nil {
 		grp.Wchans = make(map[string]int)
 	}
@@ -107,13 +223,38 @@ func (g *Grouper) Update(iter Iter) (CollectErrors, GroupByName, error) {
 	if err != nil {
 		return cerrs, nil, err
 	}
-	return cerrs, g.groups(tracked), nil
+	pressure, _ := iter.(PressureSource)
+	return cerrs, g.groups(tracked, pressure), nil
+}
+
+// pressure returns the PSI accumulated by a group, given its cgroups.
+// Only the stalls since a cgroup was last seen in the group are added,
+// since those before may predate the group's procs.  Each cgroup is only
+// counted once however many of the group's procs it holds.
+func (g *Grouper) pressure(gname string, cgroups map[string]struct{}, source PressureSource) Pressure {
+	accum := g.pressureAccum[gname]
+	last := g.pressureLast[gname]
+	cur := make(map[string]Pressure)
+	for cgroup := range cgroups {
+		p, ok := source.Pressure(cgroup)
+		if !ok {
+			continue
+		}
+		cur[cgroup] = p
+		if old, ok := last[cgroup]; ok && !p.decreased(old) {
+			accum.Add(p.Sub(old))
+		}
+	}
+	g.pressureAccum[gname] = accum
+	g.pressureLast[gname] = cur
+	return accum
 }
 
 // Translate the updates into a new GroupByName and update internal history.
-func (g *Grouper) groups(tracked []Update) GroupByName {
+func (g *Grouper) groups(tracked []Update, pressure PressureSource) GroupByName {
 	groups := make(GroupByName)
 	threadsByGroup := make(map[string][]ThreadUpdate)
+	cgroupsByGroup := make(map[string]map[string]struct{})
 
 	for _, update := range tracked {
 		groups[update.GroupName] = groupadd(groups[update.GroupName], update)
@@ -121,6 +262,12 @@ func (g *Grouper) groups(tracked []Update) GroupByName {
 			threadsByGroup[update.GroupName] =
 				append(threadsByGroup[update.GroupName], update.Threads...)
 		}
+		if update.Cgroup2 != "" {
+			if cgroupsByGroup[update.GroupName] == nil {
+				cgroupsByGroup[update.GroupName] = make(map[string]struct{})
+			}
+			cgroupsByGroup[update.GroupName][update.Cgroup2] = struct{}{}
+		}
 	}
 
 	// Add any accumulated counts to what was just observed,
@@ -131,6 +278,9 @@ func (g *Grouper) groups(tracked []Update) GroupByName {
 		}
 		g.groupAccum[gname] = group.Counts
 		group.Threads = g.threads(gname, threadsByGroup[gname])
+		if pressure != nil {
+			group.Pressure = g.pressure(gname, cgroupsByGroup[gname], pressure)
+		}
 		groups[gname] = group
 	}
 
@@ -140,9 +290,11 @@ func (g *Grouper) groups(tracked []Update) GroupByName {
 			if g.removeEmptyGroups {
 				delete(g.groupAccum, gname)
 				delete(g.threadAccum, gname)
+				delete(g.pressureAccum, gname)
 			} else {
-				groups[gname] = Group{Counts: gcounts}
+				groups[gname] = Group{Counts: gcounts, Pressure: g.pressureAccum[gname]}
 			}
+			delete(g.pressureLast, gname)
 		}
 	}
 
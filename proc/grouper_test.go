@@ -45,30 +45,76 @@ func TestGrouperBasic(t *testing.T) {
 	}{
 		{
 			[]IDInfo{
-				piinfost(p1, n1, Counts{1, 2, 3, 4, 5, 6, 0, 0}, Memory{7, 8, 0, 0, 0},
-					Filedesc{4, 400}, 2, States{Other: 1}),
-				piinfost(p2, n2, Counts{2, 3, 4, 5, 6, 7, 0, 0}, Memory{8, 9, 0, 0, 0},
-					Filedesc{40, 400}, 3, States{Waiting: 1}),
+				piinfost(p1, n1, Counts{CPUUserTime: 1, CPUSystemTime: 2, ReadBytes: 3, WriteBytes: 4, MajorPageFaults: 5, MinorPageFaults: 6}, Memory{ResidentBytes: 7, VirtualBytes: 8},
+					Filedesc{Open: 4, Limit: 400}, 2, States{Other: 1}),
+				piinfost(p2, n2, Counts{CPUUserTime: 2, CPUSystemTime: 3, ReadBytes: 4, WriteBytes: 5, MajorPageFaults: 6, MinorPageFaults: 7}, Memory{ResidentBytes: 8, VirtualBytes: 9},
+					Filedesc{Open: 40, Limit: 400}, 3, States{Waiting: 1}),
 			},
 			GroupByName{
-				"g1": Group{Counts{}, States{Other: 1}, msi{}, 1, Memory{7, 8, 0, 0, 0}, starttime,
-					4, 0.01, 2, nil},
-				"g2": Group{Counts{}, States{Waiting: 1}, msi{}, 1, Memory{8, 9, 0, 0, 0}, starttime,
-					40, 0.1, 3, nil},
+				"g1": Group{
+					States:          States{Other: 1},
+					Wchans:          msi{},
+					Procs:           1,
+					Memory:          Memory{ResidentBytes: 7, VirtualBytes: 8},
+					OldestStartTime: starttime,
+					OpenFDs:         4,
+					WorstFDratio:    0.01,
+					NumThreads:      2,
+					LastCPUs:        map[int]uint64{0: 1},
+					SchedPolicies:   map[int]uint64{0: 1},
+					Nices:           map[int]uint64{0: 1},
+				},
+				"g2": Group{
+					States:          States{Waiting: 1},
+					Wchans:          msi{},
+					Procs:           1,
+					Memory:          Memory{ResidentBytes: 8, VirtualBytes: 9},
+					OldestStartTime: starttime,
+					OpenFDs:         40,
+					WorstFDratio:    0.1,
+					NumThreads:      3,
+					LastCPUs:        map[int]uint64{0: 1},
+					SchedPolicies:   map[int]uint64{0: 1},
+					Nices:           map[int]uint64{0: 1},
+				},
 			},
 		},
 		{
 			[]IDInfo{
-				piinfost(p1, n1, Counts{2, 3, 4, 5, 6, 7, 0, 0},
-					Memory{6, 7, 0, 0, 0}, Filedesc{100, 400}, 4, States{Zombie: 1}),
-				piinfost(p2, n2, Counts{4, 5, 6, 7, 8, 9, 0, 0},
-					Memory{9, 8, 0, 0, 0}, Filedesc{400, 400}, 2, States{Running: 1}),
+				piinfost(p1, n1, Counts{CPUUserTime: 2, CPUSystemTime: 3, ReadBytes: 4, WriteBytes: 5, MajorPageFaults: 6, MinorPageFaults: 7},
+					Memory{ResidentBytes: 6, VirtualBytes: 7}, Filedesc{Open: 100, Limit: 400}, 4, States{Zombie: 1}),
+				piinfost(p2, n2, Counts{CPUUserTime: 4, CPUSystemTime: 5, ReadBytes: 6, WriteBytes: 7, MajorPageFaults: 8, MinorPageFaults: 9},
+					Memory{ResidentBytes: 9, VirtualBytes: 8}, Filedesc{Open: 400, Limit: 400}, 2, States{Running: 1}),
 			},
 			GroupByName{
-				"g1": Group{Counts{1, 1, 1, 1, 1, 1, 0, 0}, States{Zombie: 1}, msi{}, 1,
-					Memory{6, 7, 0, 0, 0}, starttime, 100, 0.25, 4, nil},
-				"g2": Group{Counts{2, 2, 2, 2, 2, 2, 0, 0}, States{Running: 1}, msi{}, 1,
-					Memory{9, 8, 0, 0, 0}, starttime, 400, 1, 2, nil},
+				"g1": Group{
+					Counts:          Counts{CPUUserTime: 1, CPUSystemTime: 1, ReadBytes: 1, WriteBytes: 1, MajorPageFaults: 1, MinorPageFaults: 1},
+					States:          States{Zombie: 1},
+					Wchans:          msi{},
+					Procs:           1,
+					Memory:          Memory{ResidentBytes: 6, VirtualBytes: 7},
+					OldestStartTime: starttime,
+					OpenFDs:         100,
+					WorstFDratio:    0.25,
+					NumThreads:      4,
+					LastCPUs:        map[int]uint64{0: 1},
+					SchedPolicies:   map[int]uint64{0: 1},
+					Nices:           map[int]uint64{0: 1},
+				},
+				"g2": Group{
+					Counts:          Counts{CPUUserTime: 2, CPUSystemTime: 2, ReadBytes: 2, WriteBytes: 2, MajorPageFaults: 2, MinorPageFaults: 2},
+					States:          States{Running: 1},
+					Wchans:          msi{},
+					Procs:           1,
+					Memory:          Memory{ResidentBytes: 9, VirtualBytes: 8},
+					OldestStartTime: starttime,
+					OpenFDs:         400,
+					WorstFDratio:    1,
+					NumThreads:      2,
+					LastCPUs:        map[int]uint64{0: 1},
+					SchedPolicies:   map[int]uint64{0: 1},
+					Nices:           map[int]uint64{0: 1},
+				},
 			},
 		},
 	}
@@ -95,35 +141,59 @@ func TestGrouperProcJoin(t *testing.T) {
 	}{
 		{
 			[]IDInfo{
-				piinfo(p1, n1, Counts{1, 2, 3, 4, 5, 6, 0, 0}, Memory{3, 4, 0, 0, 0}, Filedesc{4, 400}, 2),
+				piinfo(p1, n1, Counts{CPUUserTime: 1, CPUSystemTime: 2, ReadBytes: 3, WriteBytes: 4, MajorPageFaults: 5, MinorPageFaults: 6}, Memory{ResidentBytes: 3, VirtualBytes: 4}, Filedesc{Open: 4, Limit: 400}, 2),
 			},
 			GroupByName{
-				"g1": Group{Counts{}, States{}, msi{}, 1, Memory{3, 4, 0, 0, 0}, starttime, 4, 0.01, 2, nil},
+				"g1": Group{Wchans: msi{}, Procs: 1, Memory: Memory{ResidentBytes: 3, VirtualBytes: 4}, OldestStartTime: starttime, OpenFDs: 4, WorstFDratio: 0.01, NumThreads: 2, LastCPUs: map[int]uint64{0: 1}, SchedPolicies: map[int]uint64{0: 1}, Nices: map[int]uint64{0: 1}},
 			},
 		}, {
 			// The counts for pid2 won't be factored into the total yet because we only add
 			// to counts starting with the second time we see a proc. Memory and FDs are
 			// affected though.
 			[]IDInfo{
-				piinfost(p1, n1, Counts{3, 4, 5, 6, 7, 8, 0, 0},
-					Memory{3, 4, 0, 0, 0}, Filedesc{4, 400}, 2, States{Running: 1}),
-				piinfost(p2, n2, Counts{1, 1, 1, 1, 1, 1, 0, 0},
-					Memory{1, 2, 0, 0, 0}, Filedesc{40, 400}, 3, States{Sleeping: 1}),
+				piinfost(p1, n1, Counts{CPUUserTime: 3, CPUSystemTime: 4, ReadBytes: 5, WriteBytes: 6, MajorPageFaults: 7, MinorPageFaults: 8},
+					Memory{ResidentBytes: 3, VirtualBytes: 4}, Filedesc{Open: 4, Limit: 400}, 2, States{Running: 1}),
+				piinfost(p2, n2, Counts{CPUUserTime: 1, CPUSystemTime: 1, ReadBytes: 1, WriteBytes: 1, MajorPageFaults: 1, MinorPageFaults: 1},
+					Memory{ResidentBytes: 1, VirtualBytes: 2}, Filedesc{Open: 40, Limit: 400}, 3, States{Sleeping: 1}),
 			},
 			GroupByName{
-				"g1": Group{Counts{2, 2, 2, 2, 2, 2, 0, 0}, States{Running: 1, Sleeping: 1}, msi{}, 2,
-					Memory{4, 6, 0, 0, 0}, starttime, 44, 0.1, 5, nil},
+				"g1": Group{
+					Counts:          Counts{CPUUserTime: 2, CPUSystemTime: 2, ReadBytes: 2, WriteBytes: 2, MajorPageFaults: 2, MinorPageFaults: 2},
+					States:          States{Running: 1, Sleeping: 1},
+					Wchans:          msi{},
+					Procs:           2,
+					Memory:          Memory{ResidentBytes: 4, VirtualBytes: 6},
+					OldestStartTime: starttime,
+					OpenFDs:         44,
+					WorstFDratio:    0.1,
+					NumThreads:      5,
+					LastCPUs:        map[int]uint64{0: 2},
+					SchedPolicies:   map[int]uint64{0: 2},
+					Nices:           map[int]uint64{0: 2},
+				},
 			},
 		}, {
 			[]IDInfo{
-				piinfost(p1, n1, Counts{4, 5, 6, 7, 8, 9, 0, 0},
-					Memory{1, 5, 0, 0, 0}, Filedesc{4, 400}, 2, States{Running: 1}),
-				piinfost(p2, n2, Counts{2, 2, 2, 2, 2, 2, 0, 0},
-					Memory{2, 4, 0, 0, 0}, Filedesc{40, 400}, 3, States{Running: 1}),
+				piinfost(p1, n1, Counts{CPUUserTime: 4, CPUSystemTime: 5, ReadBytes: 6, WriteBytes: 7, MajorPageFaults: 8, MinorPageFaults: 9},
+					Memory{ResidentBytes: 1, VirtualBytes: 5}, Filedesc{Open: 4, Limit: 400}, 2, States{Running: 1}),
+				piinfost(p2, n2, Counts{CPUUserTime: 2, CPUSystemTime: 2, ReadBytes: 2, WriteBytes: 2, MajorPageFaults: 2, MinorPageFaults: 2},
+					Memory{ResidentBytes: 2, VirtualBytes: 4}, Filedesc{Open: 40, Limit: 400}, 3, States{Running: 1}),
 			},
 			GroupByName{
-				"g1": Group{Counts{4, 4, 4, 4, 4, 4, 0, 0}, States{Running: 2}, msi{}, 2,
-					Memory{3, 9, 0, 0, 0}, starttime, 44, 0.1, 5, nil},
+				"g1": Group{
+					Counts:          Counts{CPUUserTime: 4, CPUSystemTime: 4, ReadBytes: 4, WriteBytes: 4, MajorPageFaults: 4, MinorPageFaults: 4},
+					States:          States{Running: 2},
+					Wchans:          msi{},
+					Procs:           2,
+					Memory:          Memory{ResidentBytes: 3, VirtualBytes: 9},
+					OldestStartTime: starttime,
+					OpenFDs:         44,
+					WorstFDratio:    0.1,
+					NumThreads:      5,
+					LastCPUs:        map[int]uint64{0: 2},
+					SchedPolicies:   map[int]uint64{0: 2},
+					Nices:           map[int]uint64{0: 2},
+				},
 			},
 		},
 	}
@@ -150,23 +220,23 @@ func TestGrouperNonDecreasing(t *testing.T) {
 	}{
 		{
 			[]IDInfo{
-				piinfo(p1, n1, Counts{3, 4, 5, 6, 7, 8, 0, 0}, Memory{3, 4, 0, 0, 0}, Filedesc{4, 400}, 2),
-				piinfo(p2, n2, Counts{1, 1, 1, 1, 1, 1, 0, 0}, Memory{1, 2, 0, 0, 0}, Filedesc{40, 400}, 3),
+				piinfo(p1, n1, Counts{CPUUserTime: 3, CPUSystemTime: 4, ReadBytes: 5, WriteBytes: 6, MajorPageFaults: 7, MinorPageFaults: 8}, Memory{ResidentBytes: 3, VirtualBytes: 4}, Filedesc{Open: 4, Limit: 400}, 2),
+				piinfo(p2, n2, Counts{CPUUserTime: 1, CPUSystemTime: 1, ReadBytes: 1, WriteBytes: 1, MajorPageFaults: 1, MinorPageFaults: 1}, Memory{ResidentBytes: 1, VirtualBytes: 2}, Filedesc{Open: 40, Limit: 400}, 3),
 			},
 			GroupByName{
-				"g1": Group{Counts{}, States{}, msi{}, 2, Memory{4, 6, 0, 0, 0}, starttime, 44, 0.1, 5, nil},
+				"g1": Group{Wchans: msi{}, Procs: 2, Memory: Memory{ResidentBytes: 4, VirtualBytes: 6}, OldestStartTime: starttime, OpenFDs: 44, WorstFDratio: 0.1, NumThreads: 5, LastCPUs: map[int]uint64{0: 2}, SchedPolicies: map[int]uint64{0: 2}, Nices: map[int]uint64{0: 2}},
 			},
 		}, {
 			[]IDInfo{
-				piinfo(p1, n1, Counts{4, 5, 6, 7, 8, 9, 0, 0}, Memory{1, 5, 0, 0, 0}, Filedesc{4, 400}, 2),
+				piinfo(p1, n1, Counts{CPUUserTime: 4, CPUSystemTime: 5, ReadBytes: 6, WriteBytes: 7, MajorPageFaults: 8, MinorPageFaults: 9}, Memory{ResidentBytes: 1, VirtualBytes: 5}, Filedesc{Open: 4, Limit: 400}, 2),
 			},
 			GroupByName{
-				"g1": Group{Counts{1, 1, 1, 1, 1, 1, 0, 0}, States{}, msi{}, 1, Memory{1, 5, 0, 0, 0}, starttime, 4, 0.01, 2, nil},
+				"g1": Group{Counts: Counts{CPUUserTime: 1, CPUSystemTime: 1, ReadBytes: 1, WriteBytes: 1, MajorPageFaults: 1, MinorPageFaults: 1}, Wchans: msi{}, Procs: 1, Memory: Memory{ResidentBytes: 1, VirtualBytes: 5}, OldestStartTime: starttime, OpenFDs: 4, WorstFDratio: 0.01, NumThreads: 2, LastCPUs: map[int]uint64{0: 1}, SchedPolicies: map[int]uint64{0: 1}, Nices: map[int]uint64{0: 1}},
 			},
 		}, {
 			[]IDInfo{},
 			GroupByName{
-				"g1": Group{Counts{1, 1, 1, 1, 1, 1, 0, 0}, States{}, nil, 0, Memory{}, time.Time{}, 0, 0, 0, nil},
+				"g1": Group{Counts: Counts{CPUUserTime: 1, CPUSystemTime: 1, ReadBytes: 1, WriteBytes: 1, MajorPageFaults: 1, MinorPageFaults: 1}},
 			},
 		},
 	}
@@ -193,19 +263,19 @@ func TestGrouperRemoveEmptyGroups(t *testing.T) {
 	}{
 		{
 			[]IDInfo{
-				piinfo(p1, n1, Counts{3, 4, 5, 6, 7, 8, 0, 0}, Memory{3, 4, 0, 0, 0}, Filedesc{4, 400}, 2),
-				piinfo(p2, n2, Counts{1, 1, 1, 1, 1, 1, 0, 0}, Memory{1, 2, 0, 0, 0}, Filedesc{40, 400}, 3),
+				piinfo(p1, n1, Counts{CPUUserTime: 3, CPUSystemTime: 4, ReadBytes: 5, WriteBytes: 6, MajorPageFaults: 7, MinorPageFaults: 8}, Memory{ResidentBytes: 3, VirtualBytes: 4}, Filedesc{Open: 4, Limit: 400}, 2),
+				piinfo(p2, n2, Counts{CPUUserTime: 1, CPUSystemTime: 1, ReadBytes: 1, WriteBytes: 1, MajorPageFaults: 1, MinorPageFaults: 1}, Memory{ResidentBytes: 1, VirtualBytes: 2}, Filedesc{Open: 40, Limit: 400}, 3),
 			},
 			GroupByName{
-				n1: Group{Counts{}, States{}, msi{}, 1, Memory{3, 4, 0, 0, 0}, starttime, 4, 0.01, 2, nil},
-				n2: Group{Counts{}, States{}, msi{}, 1, Memory{1, 2, 0, 0, 0}, starttime, 40, 0.1, 3, nil},
+				n1: Group{Wchans: msi{}, Procs: 1, Memory: Memory{ResidentBytes: 3, VirtualBytes: 4}, OldestStartTime: starttime, OpenFDs: 4, WorstFDratio: 0.01, NumThreads: 2, LastCPUs: map[int]uint64{0: 1}, SchedPolicies: map[int]uint64{0: 1}, Nices: map[int]uint64{0: 1}},
+				n2: Group{Wchans: msi{}, Procs: 1, Memory: Memory{ResidentBytes: 1, VirtualBytes: 2}, OldestStartTime: starttime, OpenFDs: 40, WorstFDratio: 0.1, NumThreads: 3, LastCPUs: map[int]uint64{0: 1}, SchedPolicies: map[int]uint64{0: 1}, Nices: map[int]uint64{0: 1}},
 			},
 		}, {
 			[]IDInfo{
-				piinfo(p1, n1, Counts{4, 5, 6, 7, 8, 9, 0, 0}, Memory{1, 5, 0, 0, 0}, Filedesc{4, 400}, 2),
+				piinfo(p1, n1, Counts{CPUUserTime: 4, CPUSystemTime: 5, ReadBytes: 6, WriteBytes: 7, MajorPageFaults: 8, MinorPageFaults: 9}, Memory{ResidentBytes: 1, VirtualBytes: 5}, Filedesc{Open: 4, Limit: 400}, 2),
 			},
 			GroupByName{
-				n1: Group{Counts{1, 1, 1, 1, 1, 1, 0, 0}, States{}, msi{}, 1, Memory{1, 5, 0, 0, 0}, starttime, 4, 0.01, 2, nil},
+				n1: Group{Counts: Counts{CPUUserTime: 1, CPUSystemTime: 1, ReadBytes: 1, WriteBytes: 1, MajorPageFaults: 1, MinorPageFaults: 1}, Wchans: msi{}, Procs: 1, Memory: Memory{ResidentBytes: 1, VirtualBytes: 5}, OldestStartTime: starttime, OpenFDs: 4, WorstFDratio: 0.01, NumThreads: 2, LastCPUs: map[int]uint64{0: 1}, SchedPolicies: map[int]uint64{0: 1}, Nices: map[int]uint64{0: 1}},
 			},
 		}, {
 			[]IDInfo{},
@@ -222,6 +292,85 @@ func TestGrouperRemoveEmptyGroups(t *testing.T) {
 	}
 }
 
+// TestGrouperLimits verifies that groups report the lowest limit on each
+// resource, and the worst ratio between usage and limit.
+func TestGrouperLimits(t *testing.T) {
+	p1, p2 := newProc(1, "g1", Metrics{}), newProc(2, "g1", Metrics{})
+	p1.Limits = Limits{
+		"nofile":  {1024, 512},
+		"memlock": {RLimInfinity, 4096},
+		"nproc":   {4096, -1},
+	}
+	p2.Limits = Limits{
+		"nofile":  {4096, 4000},
+		"memlock": {65536, 16384},
+		"nproc":   {1024, -1},
+	}
+
+	gr := NewGrouper(newNamer("g1"), false, false, false, 0, false, false)
+	got := rungroup(t, gr, procInfoIter(p1, p2))["g1"]
+	wantLimits := map[string]uint64{"nofile": 1024, "memlock": 65536, "nproc": 1024}
+	if diff := cmp.Diff(got.Limits, wantLimits); diff != "" {
+		t.Errorf("limits differ: (-got +want)\n%s", diff)
+	}
+	wantRatios := map[string]float64{"nofile": 4000.0 / 4096, "memlock": 0.25}
+	if diff := cmp.Diff(got.WorstLimitRatio, wantRatios); diff != "" {
+		t.Errorf("worst ratios differ: (-got +want)\n%s", diff)
+	}
+}
+
+// Test that map counts are summed and the worst ratio to the limit kept.
+func TestGrouperMapCount(t *testing.T) {
+	p1, p2 := newProc(1, "g1", Metrics{}), newProc(2, "g1", Metrics{})
+	p1.MapCount, p1.MapCountLimit = 100, 65530
+	p2.MapCount, p2.MapCountLimit = 32765, 65530
+
+	gr := NewGrouper(newNamer("g1"), false, false, false, 0, false, false)
+	got := rungroup(t, gr, procInfoIter(p1, p2))["g1"]
+	if got.MapCount != 32865 {
+		t.Errorf("got %d maps, want 32865", got.MapCount)
+	}
+	if got.WorstMapCountRatio != 0.5 {
+		t.Errorf("got worst map count ratio %v, want 0.5", got.WorstMapCountRatio)
+	}
+}
+
+// pressureIter is an Iter that's also a PressureSource.
+type pressureIter struct {
+	Iter
+	pressure map[string]Pressure
+}
+
+func (p pressureIter) Pressure(cgroup string) (Pressure, bool) {
+	pressure, ok := p.pressure[cgroup]
+	return pressure, ok
+}
+
+// Test that the PSI of a group's cgroups is accumulated from when they're
+// first seen, counting cgroups shared by several procs once.
+func TestGrouperPressure(t *testing.T) {
+	p1, p2, p3 := newProc(1, "g1", Metrics{}), newProc(2, "g1", Metrics{}), newProc(3, "g1", Metrics{})
+	p1.Cgroup2, p2.Cgroup2, p3.Cgroup2 = "/a", "/a", "/b"
+
+	tests := []struct {
+		pressure map[string]Pressure
+		want     Pressure
+	}{
+		{map[string]Pressure{"/a": {CPUSome: 1}, "/b": {CPUSome: 10, IOFull: 5}}, Pressure{}},
+		{map[string]Pressure{"/a": {CPUSome: 3}, "/b": {CPUSome: 11, IOFull: 7}}, Pressure{CPUSome: 3, IOFull: 2}},
+		// /b was recreated.
+		{map[string]Pressure{"/a": {CPUSome: 4}, "/b": {CPUSome: 1}}, Pressure{CPUSome: 4, IOFull: 2}},
+	}
+
+	gr := NewGrouper(newNamer("g1"), false, false, false, 0, false, false)
+	for i, tc := range tests {
+		got := rungroup(t, gr, pressureIter{procInfoIter(p1, p2, p3), tc.pressure})["g1"].Pressure
+		if diff := cmp.Diff(got, tc.want); diff != "" {
+			t.Errorf("%d: pressure differs: (-got +want)\n%s", i, diff)
+		}
+	}
+}
+
 func TestGrouperThreads(t *testing.T) {
 	p, n, tm := 1, "g1", time.Unix(0, 0).UTC()
 
@@ -230,37 +379,70 @@ func TestGrouperThreads(t *testing.T) {
 		want GroupByName
 	}{
 		{
-			piinfot(p, n, Counts{}, Memory{}, Filedesc{1, 1}, []Thread{
-				{ThreadID(ID{p, 0}), "t1", Counts{1, 2, 3, 4, 5, 6, 0, 0}, "", States{}},
-				{ThreadID(ID{p + 1, 0}), "t2", Counts{1, 1, 1, 1, 1, 1, 0, 0}, "", States{}},
+			piinfot(p, n, Counts{}, Memory{}, Filedesc{Open: 1, Limit: 1}, []Thread{
+				{ThreadID: ThreadID(ID{p, 0}), ThreadName: "t1", Counts: Counts{CPUUserTime: 1, CPUSystemTime: 2, ReadBytes: 3, WriteBytes: 4, MajorPageFaults: 5, MinorPageFaults: 6}},
+				{ThreadID: ThreadID(ID{p + 1, 0}), ThreadName: "t2", Counts: Counts{CPUUserTime: 1, CPUSystemTime: 1, ReadBytes: 1, WriteBytes: 1, MajorPageFaults: 1, MinorPageFaults: 1}},
 			}),
 			GroupByName{
-				"g1": Group{Counts{}, States{}, msi{}, 1, Memory{}, tm, 1, 1, 2, []Threads{
-					Threads{"t1", 1, Counts{}},
-					Threads{"t2", 1, Counts{}},
-				}},
+				"g1": Group{
+					Wchans:          msi{},
+					Procs:           1,
+					OldestStartTime: tm,
+					OpenFDs:         1,
+					WorstFDratio:    1,
+					NumThreads:      2,
+					Threads: []Threads{
+						Threads{"t1", 1, Counts{}},
+						Threads{"t2", 1, Counts{}},
+					},
+					LastCPUs:      map[int]uint64{0: 2},
+					SchedPolicies: map[int]uint64{0: 2},
+					Nices:         map[int]uint64{0: 2},
+				},
 			},
 		}, {
-			piinfot(p, n, Counts{}, Memory{}, Filedesc{1, 1}, []Thread{
-				{ThreadID(ID{p, 0}), "t1", Counts{2, 3, 4, 5, 6, 7, 0, 0}, "", States{}},
-				{ThreadID(ID{p + 1, 0}), "t2", Counts{2, 2, 2, 2, 2, 2, 0, 0}, "", States{}},
-				{ThreadID(ID{p + 2, 0}), "t2", Counts{1, 1, 1, 1, 1, 1, 0, 0}, "", States{}},
+			piinfot(p, n, Counts{}, Memory{}, Filedesc{Open: 1, Limit: 1}, []Thread{
+				{ThreadID: ThreadID(ID{p, 0}), ThreadName: "t1", Counts: Counts{CPUUserTime: 2, CPUSystemTime: 3, ReadBytes: 4, WriteBytes: 5, MajorPageFaults: 6, MinorPageFaults: 7}},
+				{ThreadID: ThreadID(ID{p + 1, 0}), ThreadName: "t2", Counts: Counts{CPUUserTime: 2, CPUSystemTime: 2, ReadBytes: 2, WriteBytes: 2, MajorPageFaults: 2, MinorPageFaults: 2}},
+				{ThreadID: ThreadID(ID{p + 2, 0}), ThreadName: "t2", Counts: Counts{CPUUserTime: 1, CPUSystemTime: 1, ReadBytes: 1, WriteBytes: 1, MajorPageFaults: 1, MinorPageFaults: 1}},
 			}),
 			GroupByName{
-				"g1": Group{Counts{}, States{}, msi{}, 1, Memory{}, tm, 1, 1, 3, []Threads{
-					Threads{"t1", 1, Counts{1, 1, 1, 1, 1, 1, 0, 0}},
-					Threads{"t2", 2, Counts{1, 1, 1, 1, 1, 1, 0, 0}},
-				}},
+				"g1": Group{
+					Wchans:          msi{},
+					Procs:           1,
+					OldestStartTime: tm,
+					OpenFDs:         1,
+					WorstFDratio:    1,
+					NumThreads:      3,
+					Threads: []Threads{
+						Threads{"t1", 1, Counts{CPUUserTime: 1, CPUSystemTime: 1, ReadBytes: 1, WriteBytes: 1, MajorPageFaults: 1, MinorPageFaults: 1}},
+						Threads{"t2", 2, Counts{CPUUserTime: 1, CPUSystemTime: 1, ReadBytes: 1, WriteBytes: 1, MajorPageFaults: 1, MinorPageFaults: 1}},
+					},
+					LastCPUs:      map[int]uint64{0: 3},
+					SchedPolicies: map[int]uint64{0: 3},
+					Nices:         map[int]uint64{0: 3},
+				},
 			},
 		}, {
-			piinfot(p, n, Counts{}, Memory{}, Filedesc{1, 1}, []Thread{
-				{ThreadID(ID{p + 1, 0}), "t2", Counts{4, 4, 4, 4, 4, 4, 0, 0}, "", States{}},
-				{ThreadID(ID{p + 2, 0}), "t2", Counts{2, 3, 4, 5, 6, 7, 0, 0}, "", States{}},
+			piinfot(p, n, Counts{}, Memory{}, Filedesc{Open: 1, Limit: 1}, []Thread{
+				{ThreadID: ThreadID(ID{p + 1, 0}), ThreadName: "t2", Counts: Counts{CPUUserTime: 4, CPUSystemTime: 4, ReadBytes: 4, WriteBytes: 4, MajorPageFaults: 4, MinorPageFaults: 4}},
+				{ThreadID: ThreadID(ID{p + 2, 0}), ThreadName: "t2", Counts: Counts{CPUUserTime: 2, CPUSystemTime: 3, ReadBytes: 4, WriteBytes: 5, MajorPageFaults: 6, MinorPageFaults: 7}},
 			}),
 			GroupByName{
-				"g1": Group{Counts{}, States{}, msi{}, 1, Memory{}, tm, 1, 1, 2, []Threads{
-					Threads{"t2", 2, Counts{4, 5, 6, 7, 8, 9, 0, 0}},
-				}},
+				"g1": Group{
+					Wchans:          msi{},
+					Procs:           1,
+					OldestStartTime: tm,
+					OpenFDs:         1,
+					WorstFDratio:    1,
+					NumThreads:      2,
+					Threads: []Threads{
+						Threads{"t2", 2, Counts{CPUUserTime: 4, CPUSystemTime: 5, ReadBytes: 6, WriteBytes: 7, MajorPageFaults: 8, MinorPageFaults: 9}},
+					},
+					LastCPUs:      map[int]uint64{0: 2},
+					SchedPolicies: map[int]uint64{0: 2},
+					Nices:         map[int]uint64{0: 2},
+				},
 			},
 		},
 	}
@@ -0,0 +1,63 @@
+package proc
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// readNUMAMaps returns the memory of the proc on each NUMA node in bytes,
+// from /proc/<pid>/numa_maps.
+func (p proc) readNUMAMaps() (map[int]uint64, error) {
+	f, err := os.Open(filepath.Join(p.fs.MountPoint, strconv.Itoa(p.PID), "numa_maps"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseNUMAMaps(f)
+}
+
+// parseNUMAMaps parses the contents of a numa_maps file, returning the
+// bytes on each node.  Each line describes a mapping, with fields like
+// "N1=34" giving the pages on node 1 and "kernelpagesize_kB=4" the size of
+// those pages.  Mappings without any pages present have no such fields.
+func parseNUMAMaps(r io.Reader) (map[int]uint64, error) {
+	nodeBytes := make(map[int]uint64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var pageSize uint64
+		pages := make(map[int]uint64)
+		for _, field := range strings.Fields(scanner.Text()) {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch {
+			case kv[0] == "kernelpagesize_kB":
+				kb, err := strconv.ParseUint(kv[1], 10, 64)
+				if err != nil {
+					return nil, err
+				}
+				pageSize = kb * 1024
+			case len(kv[0]) > 1 && kv[0][0] == 'N':
+				node, err := strconv.Atoi(kv[0][1:])
+				if err != nil {
+					// Not a node, e.g. part of a file name.
+					continue
+				}
+				n, err := strconv.ParseUint(kv[1], 10, 64)
+				if err != nil {
+					return nil, err
+				}
+				pages[node] += n
+			}
+		}
+		for node, n := range pages {
+			nodeBytes[node] += n * pageSize
+		}
+	}
+	return nodeBytes, scanner.Err()
+}
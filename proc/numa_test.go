@@ -0,0 +1,24 @@
+package proc
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseNUMAMaps(t *testing.T) {
+	f, err := os.Open("../fixtures/14804/numa_maps")
+	noerr(t, err)
+	defer f.Close()
+
+	got, err := parseNUMAMaps(f)
+	noerr(t, err)
+	want := map[int]uint64{
+		0: (400+562+33)*4096 + 2048*1024,
+		1: (221+34+5)*4096 + 2048*1024,
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("numa maps differ: (-got +want)\n%s", diff)
+	}
+}
@@ -0,0 +1,250 @@
+package proc
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/procfs"
+)
+
+// hostNetNSWarning makes the failure to read the network namespace of init
+// be logged only once, rather than on every scan.
+var hostNetNSWarning sync.Once
+
+// udpClose is TCP_CLOSE, the state of bound but unconnected UDP sockets.
+const udpClose = 7
+
+// tcpStates names the socket states of include/net/tcp_states.h, as ss
+// does.
+var tcpStates = map[uint64]string{
+	1:  "ESTABLISHED",
+	2:  "SYN_SENT",
+	3:  "SYN_RECV",
+	4:  "FIN_WAIT1",
+	5:  "FIN_WAIT2",
+	6:  "TIME_WAIT",
+	7:  "CLOSE",
+	8:  "CLOSE_WAIT",
+	9:  "LAST_ACK",
+	10: "LISTEN",
+	11: "CLOSING",
+	12: "NEW_SYN_RECV",
+}
+
+type (
+	// PortSource is implemented by Iters that can find the ports procs
+	// listen on.
+	PortSource interface {
+		// ListenPorts returns the sorted TCP and UDP ports pid listens on.
+		ListenPorts(pid int) []int
+	}
+
+	// NetNSSource is implemented by Iters that can read the traffic of the
+	// network namespaces procs are in.
+	NetNSSource interface {
+		// NetDev returns the network namespace of pid and the traffic of
+		// all its interfaces but lo, or "" if pid is in the host's network
+		// namespace or it can't be read.
+		NetDev(pid int) (string, Counts)
+	}
+
+	// Socket describes an open TCP or UDP socket.
+	Socket struct {
+		// Proto is "tcp" or "udp", whether over IPv4 or IPv6.
+		Proto string
+		// State is the socket state as ss names it, e.g. "ESTABLISHED".
+		// Unconnected UDP sockets are "UNCONN".
+		State     string
+		LocalPort int
+		RxQueue   uint64
+		TxQueue   uint64
+	}
+
+	// portScanner implements PortSource by mapping the socket inodes in
+	// /proc/<pid>/fd to the sockets of the proc's network namespace.  It
+	// reads the sockets and traffic of each namespace once, so a
+	// portScanner must only be used for a single scan.
+	portScanner struct {
+		fs *FS
+		// sockets maps a network namespace to its sockets, by inode.
+		sockets map[string]map[uint64]Socket
+		// hostNetNS is the network namespace of init, read on first use, or
+		// "" if it can't be read.
+		hostNetNS *string
+		// netdev maps a network namespace to its traffic.
+		netdev map[string]Counts
+	}
+)
+
+// Listening returns true if s is a listening TCP socket or a bound but
+// unconnected UDP socket.
+func (s Socket) Listening() bool {
+	return s.LocalPort != 0 && (s.State == "LISTEN" || s.State == "UNCONN")
+}
+
+func newPortScanner(fs *FS) *portScanner {
+	return &portScanner{
+		fs:      fs,
+		sockets: make(map[string]map[uint64]Socket),
+		netdev:  make(map[string]Counts),
+	}
+}
+
+// NetDev implements NetNSSource.
+func (s *portScanner) NetDev(pid int) (string, Counts) {
+	if s.hostNetNS == nil {
+		host, err := os.Readlink(filepath.Join(s.fs.MountPoint, "1", "ns", "net"))
+		if err != nil {
+			// Reading it usually requires root.  Without it we can't tell
+			// other namespaces from the host's, whose traffic isn't ours.
+			hostNetNSWarning.Do(func() {
+				log.Printf("not counting network namespace traffic, can't read the host's network namespace: %v", err)
+			})
+		}
+		s.hostNetNS = &host
+	}
+	if *s.hostNetNS == "" {
+		return "", Counts{}
+	}
+	procDir := filepath.Join(s.fs.MountPoint, strconv.Itoa(pid))
+	netns, err := os.Readlink(filepath.Join(procDir, "ns", "net"))
+	if err != nil || netns == *s.hostNetNS {
+		return "", Counts{}
+	}
+	if counts, ok := s.netdev[netns]; ok {
+		return netns, counts
+	}
+
+	fs, err := procfs.NewFS(procDir)
+	if err != nil {
+		return "", Counts{}
+	}
+	netdev, err := fs.NetDev()
+	if err != nil {
+		return "", Counts{}
+	}
+	var counts Counts
+	for name, line := range netdev {
+		if name == "lo" {
+			continue
+		}
+		counts.NetRxBytes += line.RxBytes
+		counts.NetTxBytes += line.TxBytes
+		counts.NetRxPackets += line.RxPackets
+		counts.NetTxPackets += line.TxPackets
+		counts.NetRxDrops += line.RxDropped
+		counts.NetTxDrops += line.TxDropped
+	}
+	s.netdev[netns] = counts
+	return netns, counts
+}
+
+// netSockets returns the sockets of the network namespace of pid, by
+// inode, or nil if they can't be read.
+func (s *portScanner) netSockets(pid int) map[uint64]Socket {
+	procDir := filepath.Join(s.fs.MountPoint, strconv.Itoa(pid))
+	netns, err := os.Readlink(filepath.Join(procDir, "ns", "net"))
+	if err != nil {
+		return nil
+	}
+	sockets, ok := s.sockets[netns]
+	if !ok {
+		sockets = readSockets(procDir)
+		s.sockets[netns] = sockets
+	}
+	return sockets
+}
+
+// ListenPorts implements PortSource.  Procs that can't be read are
+// treated as not listening on any port.
+func (s *portScanner) ListenPorts(pid int) []int {
+	sockets := s.netSockets(pid)
+	if len(sockets) == 0 {
+		return nil
+	}
+
+	p, err := s.fs.Proc(pid)
+	if err != nil {
+		return nil
+	}
+	targets, err := p.FileDescriptorTargets()
+	if err != nil {
+		return nil
+	}
+	seen := make(map[int]struct{})
+	var ports []int
+	for _, target := range targets {
+		inode, ok := socketInode(target)
+		if !ok {
+			continue
+		}
+		if sock, ok := sockets[inode]; ok && sock.Listening() {
+			if _, ok := seen[sock.LocalPort]; !ok {
+				seen[sock.LocalPort] = struct{}{}
+				ports = append(ports, sock.LocalPort)
+			}
+		}
+	}
+	sort.Ints(ports)
+	return ports
+}
+
+// socketInode returns the inode of the socket given the target of its
+// /proc/<pid>/fd link, e.g. "socket:[12345]".
+func socketInode(target string) (uint64, bool) {
+	if !strings.HasPrefix(target, "socket:[") {
+		return 0, false
+	}
+	inode, err := strconv.ParseUint(strings.TrimSuffix(target[len("socket:["):], "]"), 10, 64)
+	return inode, err == nil
+}
+
+// readSockets returns the TCP and UDP sockets in the network namespace of
+// the proc whose /proc directory is procDir, by inode.
+func readSockets(procDir string) map[uint64]Socket {
+	sockets := make(map[uint64]Socket)
+	fs, err := procfs.NewFS(procDir)
+	if err != nil {
+		return sockets
+	}
+	add := func(proto string, lines procfs.NetIPSocket) {
+		for _, l := range lines {
+			if l.Inode == 0 {
+				// Not owned by any process, e.g. in TIME_WAIT.
+				continue
+			}
+			state, ok := tcpStates[l.St]
+			if !ok {
+				state = strconv.FormatUint(l.St, 10)
+			}
+			if proto == "udp" && l.St == udpClose && l.RemPort == 0 {
+				state = "UNCONN"
+			}
+			sockets[l.Inode] = Socket{
+				Proto:     proto,
+				State:     state,
+				LocalPort: int(l.LocalPort),
+				RxQueue:   l.RxQueue,
+				TxQueue:   l.TxQueue,
+			}
+		}
+	}
+	if tcp, err := fs.NetTCP(); err == nil {
+		add("tcp", procfs.NetIPSocket(tcp))
+	}
+	if tcp6, err := fs.NetTCP6(); err == nil {
+		add("tcp", procfs.NetIPSocket(tcp6))
+	}
+	if udp, err := fs.NetUDP(); err == nil {
+		add("udp", procfs.NetIPSocket(udp))
+	}
+	if udp6, err := fs.NetUDP6(); err == nil {
+		add("udp", procfs.NetIPSocket(udp6))
+	}
+	return sockets
+}
@@ -0,0 +1,151 @@
+package proc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Pressure is the pressure stall information (PSI) of a cgroup v2: the
+	// seconds during which some or all of its non-idle tasks stalled
+	// waiting for CPU, memory or I/O.
+	Pressure struct {
+		CPUSome    float64
+		CPUFull    float64
+		MemorySome float64
+		MemoryFull float64
+		IOSome     float64
+		IOFull     float64
+	}
+
+	// PressureSource is implemented by Iters that can read the PSI of
+	// cgroups.
+	PressureSource interface {
+		// Pressure returns the PSI of the cgroup v2 with the given path,
+		// as in /proc/<pid>/cgroup, or false if it can't be read.
+		Pressure(cgroup string) (Pressure, bool)
+	}
+
+	// pressureReader implements PressureSource by reading the PSI files of
+	// the cgroup v2 hierarchy mounted at root.  It reads each cgroup once,
+	// so a pressureReader must only be used for a single scan.
+	pressureReader struct {
+		root     string
+		pressure map[string]*Pressure
+	}
+)
+
+// Add adds p2 to the pressure.
+func (p *Pressure) Add(p2 Pressure) {
+	p.CPUSome += p2.CPUSome
+	p.CPUFull += p2.CPUFull
+	p.MemorySome += p2.MemorySome
+	p.MemoryFull += p2.MemoryFull
+	p.IOSome += p2.IOSome
+	p.IOFull += p2.IOFull
+}
+
+// Sub subtracts p2 from the pressure.
+func (p Pressure) Sub(p2 Pressure) Pressure {
+	p.CPUSome -= p2.CPUSome
+	p.CPUFull -= p2.CPUFull
+	p.MemorySome -= p2.MemorySome
+	p.MemoryFull -= p2.MemoryFull
+	p.IOSome -= p2.IOSome
+	p.IOFull -= p2.IOFull
+	return p
+}
+
+// decreased returns true if any stall time is lower than in p2, e.g.
+// because the cgroup was recreated.
+func (p Pressure) decreased(p2 Pressure) bool {
+	return p.CPUSome < p2.CPUSome || p.CPUFull < p2.CPUFull ||
+		p.MemorySome < p2.MemorySome || p.MemoryFull < p2.MemoryFull ||
+		p.IOSome < p2.IOSome || p.IOFull < p2.IOFull
+}
+
+func newPressureReader(root string) *pressureReader {
+	return &pressureReader{root: root, pressure: make(map[string]*Pressure)}
+}
+
+// Pressure implements PressureSource.
+func (r *pressureReader) Pressure(cgroup string) (Pressure, bool) {
+	p, ok := r.pressure[cgroup]
+	if !ok {
+		if pressure, err := readPressure(filepath.Join(r.root, cgroup)); err == nil {
+			p = &pressure
+		}
+		r.pressure[cgroup] = p
+	}
+	if p == nil {
+		return Pressure{}, false
+	}
+	return *p, true
+}
+
+// readPressure reads the cpu.pressure, memory.pressure and io.pressure
+// files of the cgroup directory dir.
+func readPressure(dir string) (Pressure, error) {
+	var p Pressure
+	for _, res := range []struct {
+		name       string
+		some, full *float64
+	}{
+		{"cpu", &p.CPUSome, &p.CPUFull},
+		{"memory", &p.MemorySome, &p.MemoryFull},
+		{"io", &p.IOSome, &p.IOFull},
+	} {
+		f, err := os.Open(filepath.Join(dir, res.name+".pressure"))
+		if err != nil {
+			return Pressure{}, err
+		}
+		*res.some, *res.full, err = parsePressure(f)
+		f.Close()
+		if err != nil {
+			return Pressure{}, err
+		}
+	}
+	return p, nil
+}
+
+// parsePressure parses a PSI file, returning the "some" and "full" total
+// stall times in seconds.  Lines look like
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=12345
+//
+// where total is in microseconds.  Older kernels have no "full" line for
+// CPU, in which case it's 0.
+func parsePressure(r io.Reader) (some, full float64, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		var total *float64
+		switch fields[0] {
+		case "some":
+			total = &some
+		case "full":
+			total = &full
+		default:
+			continue
+		}
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "total=") {
+				continue
+			}
+			usecs, err := strconv.ParseUint(strings.TrimPrefix(field, "total="), 10, 64)
+			if err != nil {
+				return 0, 0, fmt.Errorf("bad PSI total %q: %v", field, err)
+			}
+			*total = float64(usecs) / 1e6
+		}
+	}
+	return some, full, scanner.Err()
+}
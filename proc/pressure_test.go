@@ -0,0 +1,23 @@
+package proc
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReadPressure(t *testing.T) {
+	r := newPressureReader("../fixtures/sys/fs/cgroup")
+	got, ok := r.Pressure("/system.slice/docker-8dde0b0d6e919baef8d635cd9399b22639ed1e400eaec1b1cb94ff3b216cf3c3.scope")
+	if !ok {
+		t.Fatalf("can't read pressure")
+	}
+	want := Pressure{CPUSome: 1.5, CPUFull: 0.25, MemorySome: 0.042, MemoryFull: 0.021, IOSome: 3, IOFull: 2}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("pressure differs: (-got +want)\n%s", diff)
+	}
+
+	if _, ok := r.Pressure("/nonexistent"); ok {
+		t.Errorf("got pressure for nonexistent cgroup")
+	}
+}
@@ -1,10 +1,16 @@
 package proc
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/prometheus/procfs"
@@ -34,6 +40,21 @@ type (
 		ParentPid    int
 		StartTime    time.Time
 		EffectiveUID int
+		// TTY is the device number of the controlling terminal, 0 if none.
+		TTY int
+		// Session and PGRP are the session and process group ids.
+		Session int
+		PGRP    int
+		// LoginUID and SessionID identify the login session the process
+		// belongs to (audit), or are -1 if it doesn't belong to one.
+		LoginUID  int
+		SessionID int
+		// SecurityContext is the SELinux context or AppArmor label of the
+		// process, "" if there's no LSM providing one.
+		SecurityContext string
+		// Cgroup2 is the path of the process's cgroup in the cgroup v2
+		// hierarchy, "" if it isn't in one.
+		Cgroup2 string
 	}
 
 	// Counts are metric counters common to threads and processes and groups.
@@ -46,6 +67,43 @@ type (
 		MinorPageFaults       uint64
 		CtxSwitchVoluntary    uint64
 		CtxSwitchNonvoluntary uint64
+		// LogicalReadBytes and LogicalWriteBytes (rchar and wchar) count
+		// all bytes passed to read- and write-like syscalls, whether or
+		// not they caused storage I/O, e.g. page cache hits and sockets.
+		LogicalReadBytes  uint64
+		LogicalWriteBytes uint64
+		ReadSyscalls      uint64
+		WriteSyscalls     uint64
+		// CancelledWriteBytes counts bytes whose writeback was avoided,
+		// e.g. by truncating dirty page cache.
+		CancelledWriteBytes uint64
+		// CPURunTime and CPUWaitTime are the seconds spent running on a
+		// CPU and waiting for one, and Timeslices the number of times
+		// run, from /proc/<pid>/schedstat.
+		CPURunTime  float64
+		CPUWaitTime float64
+		Timeslices  uint64
+		// BlkIODelayTime is the seconds spent waiting for block I/O, if
+		// delay accounting is enabled.
+		BlkIODelayTime float64
+		// CPUGuestTime is the part of CPUUserTime spent running a virtual
+		// CPU, and CPUChildrenGuestTime that of waited-for children.
+		CPUGuestTime         float64
+		CPUChildrenGuestTime float64
+		// CPUChildrenUserTime and CPUChildrenSystemTime are the seconds
+		// used by children that exited and were waited for, including
+		// those too short-lived for us to ever see.
+		CPUChildrenUserTime   float64
+		CPUChildrenSystemTime float64
+		// NetRxBytes etc. are the traffic of all the interfaces but lo of
+		// a network namespace other than the host's.  They're only set in
+		// the proc that owns the namespace, see Tracker.ownNetNS.
+		NetRxBytes   uint64
+		NetTxBytes   uint64
+		NetRxPackets uint64
+		NetTxPackets uint64
+		NetRxDrops   uint64
+		NetTxDrops   uint64
 	}
 
 	// Memory describes a proc's memory usage.
@@ -55,14 +113,61 @@ type (
 		VmSwapBytes           uint64
 		ProportionalBytes     uint64
 		ProportionalSwapBytes uint64
+		// RssAnonBytes, RssFileBytes and RssShmemBytes break down
+		// ResidentBytes into anonymous, file-backed and shared memory.
+		RssAnonBytes  uint64
+		RssFileBytes  uint64
+		RssShmemBytes uint64
+		// VmHWMBytes is the peak resident memory.
+		VmHWMBytes   uint64
+		VmLckBytes   uint64
+		VmPTEBytes   uint64
+		HugetlbBytes uint64
+		// AnonHugePagesBytes and UniqueBytes (USS, i.e. private clean and
+		// dirty memory) are only gathered along with ProportionalBytes.
+		AnonHugePagesBytes uint64
+		UniqueBytes        uint64
+		// MapCount is the number of memory maps, i.e. lines in
+		// /proc/<pid>/maps, and MapCountLimit the vm.max_map_count sysctl.
+		MapCount      uint64
+		MapCountLimit uint64
+		// NUMANodeBytes is the memory on each NUMA node, if asked for.
+		NUMANodeBytes map[int]uint64
 	}
 
+	// Limit is a proc's soft limit on a resource, and its usage of the
+	// resource, -1 if that can't be measured.  Usage is in the units of
+	// the limit, e.g. bytes or seconds.
+	Limit struct {
+		Soft  uint64
+		Usage float64
+	}
+
+	// Limits maps resource names, e.g. "nofile" or "memlock", to a
+	// proc's limits.
+	Limits map[string]Limit
+
 	// Filedesc describes a proc's file descriptor usage and soft limit.
 	Filedesc struct {
 		// Open is the count of open file descriptors, -1 if unknown.
 		Open int64
 		// Limit is the fd soft limit for the process.
 		Limit uint64
+		// ByType counts open file descriptors by type, see FDType.  It's
+		// only gathered if asked for.
+		ByType map[string]int
+		// Deleted holds the size of the deleted files still open, if
+		// asked for.
+		Deleted map[FileID]uint64
+		// Sockets holds the open TCP and UDP sockets by inode, if asked
+		// for.
+		Sockets map[uint64]Socket
+	}
+
+	// FileID identifies a file by device and inode.
+	FileID struct {
+		Dev uint64
+		Ino uint64
 	}
 
 	// States counts how many threads are in each state.
@@ -82,6 +187,21 @@ type (
 		NumThreads uint64
 		States
 		Wchan string
+		Limits
+		Sched
+	}
+
+	// Sched describes how a proc or thread is scheduled.
+	Sched struct {
+		// LastCPU is the CPU it last ran on.
+		LastCPU int
+		// CPUsAllowed is the number of CPUs it may run on, from
+		// Cpus_allowed_list.  It's only read for procs, not threads.
+		CPUsAllowed int
+		// Policy is the scheduling policy, see PolicyName, and Nice the
+		// nice value.
+		Policy int
+		Nice   int
 	}
 
 	// Thread contains per-thread data.
@@ -91,6 +211,7 @@ type (
 		Counts
 		Wchan string
 		States
+		Sched
 	}
 
 	// IDInfo groups all info for a single process.
@@ -124,6 +245,8 @@ type (
 		GetMetrics() (Metrics, int, error)
 		GetStates() (States, error)
 		GetWchan() (string, error)
+		// GetSched() returns how the proc is scheduled.
+		GetSched() (Sched, error)
 		GetCounts() (Counts, int, error)
 		GetThreads() ([]Thread, error)
 	}
@@ -140,6 +263,9 @@ type (
 		io      *procfs.ProcIO
 		fs      *FS
 		wchan   *string
+		ports   *portScanner
+		// maxMapCount is vm.max_map_count, 0 if it couldn't be read.
+		maxMapCount uint64
 	}
 
 	proc struct {
@@ -154,8 +280,10 @@ type (
 
 	// procfsprocs implements procs using procfs.
 	procfsprocs struct {
-		Procs []procfs.Proc
-		fs    *FS
+		Procs       []procfs.Proc
+		fs          *FS
+		ports       *portScanner
+		maxMapCount uint64
 	}
 
 	// Iter is an iterator over a sequence of procs.
@@ -180,6 +308,10 @@ type (
 		// Proc is the current iteration variable, or nil if Next() has never been called or the
 		// iterator is exhausted.
 		Proc
+		// ports finds the ports procs listen on, if the source can.
+		ports *portScanner
+		// pressure reads the PSI of cgroups, if the source can.
+		pressure *pressureReader
 	}
 
 	// Source is a source of procs.
@@ -194,7 +326,21 @@ type (
 		BootTime    uint64
 		MountPoint  string
 		GatherSMaps bool
-		debug       bool
+		// GatherFDTypes makes the type of each open fd be determined.
+		GatherFDTypes bool
+		// GatherDeletedFiles makes the deleted files still open be found.
+		GatherDeletedFiles bool
+		// GatherSockets makes the TCP and UDP sockets open be found.
+		GatherSockets bool
+		// GatherNetNS makes the traffic of network namespaces other than
+		// the host's be counted.
+		GatherNetNS bool
+		// GatherNUMAMaps makes the memory on each NUMA node be read.
+		GatherNUMAMaps bool
+		// CgroupMountPoint is where the cgroup v2 hierarchy is mounted, to
+		// read the PSI of cgroups from, or "" not to.
+		CgroupMountPoint string
+		debug            bool
 	}
 )
 
@@ -212,6 +358,25 @@ func (c *Counts) Add(c2 Delta) {
 	c.MinorPageFaults += c2.MinorPageFaults
 	c.CtxSwitchVoluntary += c2.CtxSwitchVoluntary
 	c.CtxSwitchNonvoluntary += c2.CtxSwitchNonvoluntary
+	c.LogicalReadBytes += c2.LogicalReadBytes
+	c.LogicalWriteBytes += c2.LogicalWriteBytes
+	c.ReadSyscalls += c2.ReadSyscalls
+	c.WriteSyscalls += c2.WriteSyscalls
+	c.CancelledWriteBytes += c2.CancelledWriteBytes
+	c.CPURunTime += c2.CPURunTime
+	c.CPUWaitTime += c2.CPUWaitTime
+	c.Timeslices += c2.Timeslices
+	c.BlkIODelayTime += c2.BlkIODelayTime
+	c.CPUGuestTime += c2.CPUGuestTime
+	c.CPUChildrenGuestTime += c2.CPUChildrenGuestTime
+	c.CPUChildrenUserTime += c2.CPUChildrenUserTime
+	c.CPUChildrenSystemTime += c2.CPUChildrenSystemTime
+	c.NetRxBytes += c2.NetRxBytes
+	c.NetTxBytes += c2.NetTxBytes
+	c.NetRxPackets += c2.NetRxPackets
+	c.NetTxPackets += c2.NetTxPackets
+	c.NetRxDrops += c2.NetRxDrops
+	c.NetTxDrops += c2.NetTxDrops
 }
 
 // Sub subtracts c2 from the counts.
@@ -224,6 +389,25 @@ func (c Counts) Sub(c2 Counts) Delta {
 	c.MinorPageFaults -= c2.MinorPageFaults
 	c.CtxSwitchVoluntary -= c2.CtxSwitchVoluntary
 	c.CtxSwitchNonvoluntary -= c2.CtxSwitchNonvoluntary
+	c.LogicalReadBytes -= c2.LogicalReadBytes
+	c.LogicalWriteBytes -= c2.LogicalWriteBytes
+	c.ReadSyscalls -= c2.ReadSyscalls
+	c.WriteSyscalls -= c2.WriteSyscalls
+	c.CancelledWriteBytes -= c2.CancelledWriteBytes
+	c.CPURunTime -= c2.CPURunTime
+	c.CPUWaitTime -= c2.CPUWaitTime
+	c.Timeslices -= c2.Timeslices
+	c.BlkIODelayTime -= c2.BlkIODelayTime
+	c.CPUGuestTime -= c2.CPUGuestTime
+	c.CPUChildrenGuestTime -= c2.CPUChildrenGuestTime
+	c.CPUChildrenUserTime -= c2.CPUChildrenUserTime
+	c.CPUChildrenSystemTime -= c2.CPUChildrenSystemTime
+	c.NetRxBytes -= c2.NetRxBytes
+	c.NetTxBytes -= c2.NetTxBytes
+	c.NetRxPackets -= c2.NetRxPackets
+	c.NetTxPackets -= c2.NetTxPackets
+	c.NetRxDrops -= c2.NetRxDrops
+	c.NetTxDrops -= c2.NetTxDrops
 	return Delta(c)
 }
 
@@ -273,6 +457,10 @@ func (p IDInfo) GetWchan() (string, error) {
 	return p.Wchan, nil
 }
 
+func (p IDInfo) GetSched() (Sched, error) {
+	return p.Sched, nil
+}
+
 func (p *proccache) GetPid() int {
 	return p.Proc.PID
 }
@@ -359,6 +547,38 @@ func (p *proccache) getIo() (procfs.ProcIO, error) {
 	return *p.io, nil
 }
 
+// readID reads a file under /proc/<pid> holding a single id such as
+// loginuid, returning -1 if the id is unset or can't be read.
+func (p *proccache) readID(name string) int {
+	buf, err := os.ReadFile(filepath.Join(p.fs.MountPoint, strconv.Itoa(p.GetPid()), name))
+	if err != nil {
+		return -1
+	}
+	id, err := strconv.ParseUint(strings.TrimSpace(string(buf)), 10, 32)
+	// (uint32)-1 means unset.
+	if err != nil || id == 1<<32-1 {
+		return -1
+	}
+	return int(id)
+}
+
+// readSecurityContext returns the security context of the proc, from
+// /proc/<pid>/attr/current or, when LSMs are stacked and that's not the
+// one AppArmor uses, /proc/<pid>/attr/apparmor/current.
+func (p *proccache) readSecurityContext() string {
+	dir := filepath.Join(p.fs.MountPoint, strconv.Itoa(p.GetPid()), "attr")
+	for _, name := range []string{"current", filepath.Join("apparmor", "current")} {
+		buf, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		if ctx := strings.TrimRight(string(buf), "\x00\n"); ctx != "" {
+			return ctx
+		}
+	}
+	return ""
+}
+
 // GetStatic returns the ProcStatic corresponding to this proc.
 func (p *proccache) GetStatic() (Static, error) {
 	// /proc/<pid>/cmdline is normally world-readable.
@@ -386,24 +606,53 @@ func (p *proccache) GetStatic() (Static, error) {
 	// case.
 	cgroups, err := p.getCgroups()
 	var cgroupsStr []string
+	var cgroup2 string
 	if err != nil {
 		cgroupsStr = []string{}
 	} else {
 		for _, c := range cgroups {
 			cgroupsStr = append(cgroupsStr, c.Path)
+			if c.HierarchyID == 0 {
+				cgroup2 = c.Path
+			}
 		}
 	}
 
 	return Static{
-		Name:         stat.Comm,
-		Cmdline:      cmdline,
-		Cgroups:      cgroupsStr,
-		ParentPid:    stat.PPID,
-		StartTime:    startTime,
-		EffectiveUID: int(status.UIDs[1]),
+		Name:            stat.Comm,
+		Cmdline:         cmdline,
+		Cgroups:         cgroupsStr,
+		ParentPid:       stat.PPID,
+		StartTime:       startTime,
+		EffectiveUID:    int(status.UIDs[1]),
+		TTY:             stat.TTY,
+		Session:         stat.Session,
+		PGRP:            stat.PGRP,
+		LoginUID:        p.readID("loginuid"),
+		SessionID:       p.readID("sessionid"),
+		SecurityContext: p.readSecurityContext(),
+		Cgroup2:         cgroup2,
 	}, nil
 }
 
+// TTYName returns the name under /dev of the terminal with device number
+// tty, e.g. "pts/3", or "" if tty is 0.
+func TTYName(tty int) string {
+	if tty == 0 {
+		return ""
+	}
+	major, minor := (tty>>8)&0xfff, (tty&0xff)|((tty>>12)&0xfff00)
+	switch {
+	case major >= 136 && major <= 143:
+		return fmt.Sprintf("pts/%d", (major-136)*256+minor)
+	case major == 4 && minor < 64:
+		return fmt.Sprintf("tty%d", minor)
+	case major == 4:
+		return fmt.Sprintf("ttyS%d", minor-64)
+	}
+	return fmt.Sprintf("%d:%d", major, minor)
+}
+
 func (p proc) GetCounts() (Counts, int, error) {
 	stat, err := p.getStat()
 	if err != nil {
@@ -426,6 +675,13 @@ func (p proc) GetCounts() (Counts, int, error) {
 	if err != nil {
 		softerrors++
 	}
+
+	// Kernels without CONFIG_SCHED_INFO have no schedstat.
+	sched, err := p.Proc.Schedstat()
+	if err != nil && !os.IsNotExist(err) {
+		softerrors |= 1
+	}
+
 	return Counts{
 		CPUUserTime:           float64(stat.UTime) / userHZ,
 		CPUSystemTime:         float64(stat.STime) / userHZ,
@@ -435,6 +691,19 @@ func (p proc) GetCounts() (Counts, int, error) {
 		MinorPageFaults:       uint64(stat.MinFlt),
 		CtxSwitchVoluntary:    uint64(status.VoluntaryCtxtSwitches),
 		CtxSwitchNonvoluntary: uint64(status.NonVoluntaryCtxtSwitches),
+		LogicalReadBytes:      io.RChar,
+		LogicalWriteBytes:     io.WChar,
+		ReadSyscalls:          io.SyscR,
+		WriteSyscalls:         io.SyscW,
+		CancelledWriteBytes:   uint64(io.CancelledWriteBytes),
+		CPURunTime:            float64(sched.RunningNanoseconds) / 1e9,
+		CPUWaitTime:           float64(sched.WaitingNanoseconds) / 1e9,
+		Timeslices:            sched.RunTimeslices,
+		BlkIODelayTime:        float64(stat.DelayAcctBlkIOTicks) / userHZ,
+		CPUGuestTime:          float64(stat.GuestTime) / userHZ,
+		CPUChildrenGuestTime:  float64(stat.CGuestTime) / userHZ,
+		CPUChildrenUserTime:   float64(stat.CUTime) / userHZ,
+		CPUChildrenSystemTime: float64(stat.CSTime) / userHZ,
 	}, softerrors, nil
 }
 
@@ -442,6 +711,44 @@ func (p proc) GetWchan() (string, error) {
 	return p.getWchan()
 }
 
+// GetSched implements Proc.
+func (p proc) GetSched() (Sched, error) {
+	stat, err := p.getStat()
+	if err != nil {
+		return Sched{}, err
+	}
+	return Sched{LastCPU: int(stat.Processor), Policy: int(stat.Policy), Nice: stat.Nice}, nil
+}
+
+// policyNames names the scheduling policies of sched(7).
+var policyNames = map[int]string{
+	0: "OTHER",
+	1: "FIFO",
+	2: "RR",
+	3: "BATCH",
+	5: "IDLE",
+	6: "DEADLINE",
+}
+
+// PolicyName returns the name of a scheduling policy as in sched(7) minus
+// the SCHED_ prefix, e.g. "FIFO", or its number if it's unknown.
+func PolicyName(policy int) string {
+	if name, ok := policyNames[policy]; ok {
+		return name
+	}
+	return strconv.Itoa(policy)
+}
+
+// PolicyNames returns the names of the known scheduling policies.
+func PolicyNames() []string {
+	names := make([]string, 0, len(policyNames))
+	for _, name := range policyNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (p proc) GetStates() (States, error) {
 	stat, err := p.getStat()
 	if err != nil {
@@ -490,45 +797,374 @@ func (p proc) GetMetrics() (Metrics, int, error) {
 		softerrors |= 1
 	}
 
-	limits, err := p.Proc.NewLimits()
+	limits, err := p.readLimits()
 	if err != nil {
 		return Metrics{}, 0, err
 	}
 
+	sigq, err := p.readSigQ()
+	if err != nil {
+		sigq = -1
+		softerrors |= 1
+	}
+
 	wchan, err := p.getWchan()
 	if err != nil {
 		softerrors |= 1
 	}
 
+	filedesc := Filedesc{
+		Open:  int64(numfds),
+		Limit: limits["nofile"],
+	}
+	if p.fs.GatherFDTypes || p.fs.GatherDeletedFiles || p.fs.GatherSockets {
+		if err := p.readFDs(&filedesc); err != nil {
+			softerrors |= 1
+		}
+	}
+
 	memory := Memory{
 		ResidentBytes: uint64(stat.ResidentMemory()),
 		VirtualBytes:  uint64(stat.VirtualMemory()),
 		VmSwapBytes:   uint64(status.VmSwap),
+		RssAnonBytes:  status.RssAnon,
+		RssFileBytes:  status.RssFile,
+		RssShmemBytes: status.RssShmem,
+		VmHWMBytes:    status.VmHWM,
+		VmLckBytes:    status.VmLck,
+		VmPTEBytes:    status.VmPTE,
+		HugetlbBytes:  status.HugetlbPages,
+		MapCountLimit: p.maxMapCount,
+	}
+	if memory.MapCount, err = p.countMaps(); err != nil {
+		softerrors |= 1
 	}
 
 	if p.proccache.fs.GatherSMaps {
-		smaps, err := p.Proc.ProcSMapsRollup()
-		if err != nil {
+		if err := p.readSMapsRollup(&memory); err != nil {
+			softerrors |= 1
+		}
+	}
+
+	if p.fs.GatherNUMAMaps {
+		if memory.NUMANodeBytes, err = p.readNUMAMaps(); err != nil {
 			softerrors |= 1
-		} else {
-			memory.ProportionalBytes = smaps.Pss
-			memory.ProportionalSwapBytes = smaps.SwapPss
 		}
 	}
 
 	return Metrics{
-		Counts: counts,
-		Memory: memory,
-		Filedesc: Filedesc{
-			Open:  int64(numfds),
-			Limit: uint64(limits.OpenFiles),
-		},
+		Counts:     counts,
+		Memory:     memory,
+		Filedesc:   filedesc,
 		NumThreads: uint64(stat.NumThreads),
 		States:     states,
 		Wchan:      wchan,
+		Limits:     newLimits(limits, stat, status, numfds, sigq),
+		Sched: Sched{
+			LastCPU:     int(stat.Processor),
+			CPUsAllowed: len(status.CpusAllowedList),
+			Policy:      int(stat.Policy),
+			Nice:        stat.Nice,
+		},
 	}, softerrors, nil
 }
 
+// countMaps returns the number of lines in /proc/<pid>/maps, which is
+// much cheaper to read than smaps.
+func (p proc) countMaps() (uint64, error) {
+	f, err := os.Open(filepath.Join(p.fs.MountPoint, strconv.Itoa(p.PID), "maps"))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var count uint64
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := f.Read(buf)
+		count += uint64(bytes.Count(buf[:n], []byte{'\n'}))
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// readUintFile returns the unsigned integer a file contains, e.g. a sysctl.
+func readUintFile(path string) (uint64, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(buf)), 10, 64)
+}
+
+// tmpfsMagic is the statfs type of tmpfs, see statfs(2).
+const tmpfsMagic = 0x01021994
+
+// readFDs reads the link of each open fd of the proc, filling in the
+// count of fds by type, the deleted files still open and the sockets, as
+// the FS asks for.
+func (p proc) readFDs(filedesc *Filedesc) error {
+	dir := filepath.Join(p.fs.MountPoint, strconv.Itoa(p.PID), "fd")
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	names, err := d.Readdirnames(-1)
+	d.Close()
+	if err != nil {
+		return err
+	}
+
+	var fdTypes map[string]int
+	if p.fs.GatherFDTypes {
+		fdTypes = make(map[string]int)
+	}
+	var deleted map[FileID]uint64
+	if p.fs.GatherDeletedFiles {
+		deleted = make(map[FileID]uint64)
+	}
+	var netSockets, sockets map[uint64]Socket
+	if p.fs.GatherSockets && p.ports != nil {
+		netSockets = p.ports.netSockets(p.PID)
+		sockets = make(map[uint64]Socket)
+	}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		target, err := os.Readlink(path)
+		if err != nil {
+			// The fd was closed since we listed them.
+			continue
+		}
+		if fdTypes != nil {
+			fdTypes[FDType(target)]++
+		}
+		if inode, ok := socketInode(target); ok && sockets != nil {
+			if sock, ok := netSockets[inode]; ok {
+				sockets[inode] = sock
+			}
+		}
+		if deleted != nil && strings.HasPrefix(target, "/") && strings.HasSuffix(target, " (deleted)") &&
+			!strings.HasPrefix(target, "/memfd:") {
+			// Stat follows the link to the file, even though it has
+			// no name anymore.
+			fi, err := os.Stat(path)
+			if err != nil || !fi.Mode().IsRegular() {
+				continue
+			}
+			// Files on tmpfs, e.g. in /dev/shm, hold memory rather than
+			// disk space.
+			var sfs syscall.Statfs_t
+			if err := syscall.Statfs(path, &sfs); err != nil || int64(sfs.Type) == tmpfsMagic {
+				continue
+			}
+			if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+				deleted[FileID{uint64(st.Dev), uint64(st.Ino)}] = uint64(fi.Size())
+			}
+		}
+	}
+	filedesc.ByType, filedesc.Deleted, filedesc.Sockets = fdTypes, deleted, sockets
+	return nil
+}
+
+// FDType returns the type of an open file descriptor given the target of
+// its /proc/<pid>/fd link: "socket", "pipe", "file", "device", "eventfd",
+// "epoll", "timerfd", "signalfd", "inotify", "anon_inode" for other
+// anonymous inodes, or "other", e.g. for namespaces.
+func FDType(target string) string {
+	switch {
+	case strings.HasPrefix(target, "socket:"):
+		return "socket"
+	case strings.HasPrefix(target, "pipe:"):
+		return "pipe"
+	case strings.HasPrefix(target, "/dev/"):
+		return "device"
+	case strings.HasPrefix(target, "/"):
+		return "file"
+	case strings.HasPrefix(target, "anon_inode:"):
+		switch strings.Trim(strings.TrimPrefix(target, "anon_inode:"), "[]") {
+		case "eventfd":
+			return "eventfd"
+		case "eventpoll":
+			return "epoll"
+		case "timerfd":
+			return "timerfd"
+		case "signalfd":
+			return "signalfd"
+		case "inotify":
+			return "inotify"
+		}
+		return "anon_inode"
+	}
+	return "other"
+}
+
+// RLimInfinity is the soft limit of resources that are unlimited.
+const RLimInfinity = ^uint64(0)
+
+// Ratio returns how close usage is to the limit, 0 if unlimited, or false
+// if usage can't be measured.
+func (l Limit) Ratio() (float64, bool) {
+	if l.Usage < 0 {
+		return 0, false
+	}
+	if l.Soft == RLimInfinity || l.Soft == 0 {
+		return 0, true
+	}
+	return l.Usage / float64(l.Soft), true
+}
+
+// limitNames maps the resources in /proc/<pid>/limits to their names in
+// getrlimit(2), minus the RLIMIT_ prefix.
+var limitNames = map[string]string{
+	"Max cpu time":          "cpu",
+	"Max file size":         "fsize",
+	"Max data size":         "data",
+	"Max stack size":        "stack",
+	"Max core file size":    "core",
+	"Max resident set":      "rss",
+	"Max processes":         "nproc",
+	"Max open files":        "nofile",
+	"Max locked memory":     "memlock",
+	"Max address space":     "as",
+	"Max file locks":        "locks",
+	"Max pending signals":   "sigpending",
+	"Max msgqueue size":     "msgqueue",
+	"Max nice priority":     "nice",
+	"Max realtime priority": "rtprio",
+	"Max realtime timeout":  "rttime",
+}
+
+// readLimits returns the soft limits of the proc by resource name, see
+// limitNames.  We parse /proc/<pid>/limits ourselves because
+// procfs.ProcLimits misses some resources, e.g. "Max processes".
+func (p proc) readLimits() (map[string]uint64, error) {
+	buf, err := os.ReadFile(filepath.Join(p.fs.MountPoint, strconv.Itoa(p.PID), "limits"))
+	if err != nil {
+		return nil, err
+	}
+	limits := make(map[string]uint64)
+	for _, line := range strings.Split(string(buf), "\n") {
+		// Lines look like "Max open files            1024                 4096                 files     ",
+		// the resource being padded to 25 chars.
+		if len(line) <= 26 {
+			continue
+		}
+		name, ok := limitNames[strings.TrimSpace(line[:25])]
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(line[26:])
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("bad limits line %q", line)
+		}
+		soft := RLimInfinity
+		if fields[0] != "unlimited" {
+			soft, err = strconv.ParseUint(fields[0], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad limits line %q: %v", line, err)
+			}
+		}
+		limits[name] = soft
+	}
+	return limits, nil
+}
+
+// readSigQ returns the number of signals queued for the real user of the
+// proc, from field SigQ of /proc/<pid>/status, which procfs.ProcStatus lacks.
+func (p proc) readSigQ() (int, error) {
+	buf, err := os.ReadFile(filepath.Join(p.fs.MountPoint, strconv.Itoa(p.PID), "status"))
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(buf), "\n") {
+		// The line looks like "SigQ:	0/31421", the limit coming last.
+		if v, ok := strings.CutPrefix(line, "SigQ:"); ok {
+			queued, _, _ := strings.Cut(strings.TrimSpace(v), "/")
+			return strconv.Atoi(queued)
+		}
+	}
+	return 0, fmt.Errorf("no SigQ in status")
+}
+
+// newLimits returns the limits of a proc along with its usage of the
+// resources it's practical to measure given what we read anyway.
+func newLimits(soft map[string]uint64, stat procfs.ProcStat, status procfs.ProcStatus, numfds, sigq int) Limits {
+	usage := map[string]float64{
+		"cpu":     stat.CPUTime(),
+		"data":    float64(status.VmData),
+		"stack":   float64(status.VmStk),
+		"rss":     float64(stat.ResidentMemory()),
+		"memlock": float64(status.VmLck),
+		"as":      float64(stat.VirtualMemory()),
+	}
+	if numfds >= 0 {
+		usage["nofile"] = float64(numfds)
+	}
+	if sigq >= 0 {
+		usage["sigpending"] = float64(sigq)
+	}
+	limits := make(Limits, len(soft))
+	for res, l := range soft {
+		u, ok := usage[res]
+		if !ok {
+			u = -1
+		}
+		limits[res] = Limit{l, u}
+	}
+	return limits
+}
+
+// readSMapsRollup fills in the fields of memory gathered from
+// /proc/<pid>/smaps_rollup.  procfs.ProcSMapsRollup lacks AnonHugePages,
+// so we parse the file ourselves, falling back to procfs, which sums
+// /proc/<pid>/smaps, on kernels without smaps_rollup.
+func (p proc) readSMapsRollup(memory *Memory) error {
+	f, err := os.Open(filepath.Join(p.fs.MountPoint, strconv.Itoa(p.PID), "smaps_rollup"))
+	if os.IsNotExist(err) {
+		smaps, err := p.Proc.ProcSMapsRollup()
+		if err != nil {
+			return err
+		}
+		memory.ProportionalBytes = smaps.Pss
+		memory.ProportionalSwapBytes = smaps.SwapPss
+		memory.UniqueBytes = smaps.PrivateClean + smaps.PrivateDirty
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Lines look like "Pss:                 1234 kB".
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || fields[2] != "kB" {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		bytes := kb * 1024
+		switch fields[0] {
+		case "Pss:":
+			memory.ProportionalBytes = bytes
+		case "SwapPss:":
+			memory.ProportionalSwapBytes = bytes
+		case "Private_Clean:", "Private_Dirty:":
+			memory.UniqueBytes += bytes
+		case "AnonHugePages:":
+			memory.AnonHugePagesBytes = bytes
+		}
+	}
+	return scanner.Err()
+}
+
 func (p proc) GetThreads() ([]Thread, error) {
 	fs, err := p.fs.threadFs(p.PID)
 	if err != nil {
@@ -558,6 +1194,7 @@ func (p proc) GetThreads() ([]Thread, error) {
 
 		wchan, _ := iter.GetWchan()
 		states, _ := iter.GetStates()
+		sched, _ := iter.GetSched()
 
 		threads = append(threads, Thread{
 			ThreadID:   ThreadID(id),
@@ -565,6 +1202,7 @@ func (p proc) GetThreads() ([]Thread, error) {
 			Counts:     counts,
 			Wchan:      wchan,
 			States:     states,
+			Sched:      sched,
 		})
 	}
 	err = iter.Close()
@@ -592,16 +1230,19 @@ func NewFS(mountPoint string, debug bool) (*FS, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &FS{fs, stat.BootTime, mountPoint, false, debug}, nil
+	return &FS{FS: fs, BootTime: stat.BootTime, MountPoint: mountPoint, debug: debug}, nil
 }
 
 func (fs *FS) threadFs(pid int) (*FS, error) {
 	mountPoint := filepath.Join(fs.MountPoint, strconv.Itoa(pid), "task")
-	tfs, err := procfs.NewFS(mountPoint)
+	pfs, err := procfs.NewFS(mountPoint)
 	if err != nil {
 		return nil, err
 	}
-	return &FS{tfs, fs.BootTime, mountPoint, fs.GatherSMaps, false}, nil
+	// Threads are read with the same options as their process.
+	tfs := *fs
+	tfs.FS, tfs.MountPoint, tfs.debug = pfs, mountPoint, false
+	return &tfs, nil
 }
 
 // AllProcs implements Source.
@@ -610,12 +1251,18 @@ func (fs *FS) AllProcs() Iter {
 	if err != nil {
 		err = fmt.Errorf("Error reading procs: %v", err)
 	}
-	return &procIterator{procs: procfsprocs{procs, fs}, err: err, idx: -1}
+	ports := newPortScanner(fs)
+	maxMapCount, _ := readUintFile(filepath.Join(fs.MountPoint, "sys", "vm", "max_map_count"))
+	iter := &procIterator{procs: procfsprocs{procs, fs, ports, maxMapCount}, err: err, idx: -1, ports: ports}
+	if fs.CgroupMountPoint != "" {
+		iter.pressure = newPressureReader(fs.CgroupMountPoint)
+	}
+	return iter
 }
 
 // get implements procs.
 func (p procfsprocs) get(i int) Proc {
-	return &proc{proccache{Proc: p.Procs[i], fs: p.fs}}
+	return &proc{proccache{Proc: p.Procs[i], fs: p.fs, ports: p.ports, maxMapCount: p.maxMapCount}}
 }
 
 // length implements procs.
@@ -634,6 +1281,30 @@ func (pi *procIterator) Next() bool {
 	return pi.idx < pi.procs.length()
 }
 
+// ListenPorts implements PortSource.
+func (pi *procIterator) ListenPorts(pid int) []int {
+	if pi.ports == nil {
+		return nil
+	}
+	return pi.ports.ListenPorts(pid)
+}
+
+// NetDev implements NetNSSource.
+func (pi *procIterator) NetDev(pid int) (string, Counts) {
+	if pi.ports == nil || !pi.ports.fs.GatherNetNS {
+		return "", Counts{}
+	}
+	return pi.ports.NetDev(pid)
+}
+
+// Pressure implements PressureSource.
+func (pi *procIterator) Pressure(cgroup string) (Pressure, bool) {
+	if pi.pressure == nil {
+		return Pressure{}, false
+	}
+	return pi.pressure.Pressure(cgroup)
+}
+
 // Close implements Iter.
 func (pi *procIterator) Close() error {
 	pi.Next()
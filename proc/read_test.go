@@ -2,12 +2,17 @@ package proc
 
 import (
 	"fmt"
+	"io/ioutil"
+	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"golang.org/x/sys/unix"
 )
 
 type (
@@ -61,12 +66,19 @@ func TestReadFixture(t *testing.T) {
 
 	stime, _ := time.Parse(time.RFC3339Nano, "2017-10-19T22:52:51.19Z")
 	wantstatic := Static{
-		Name:         "process-exporte",
-		Cmdline:      []string{"./process-exporter", "-procnames", "bash"},
-		Cgroups:      []string{"/system.slice/docker-8dde0b0d6e919baef8d635cd9399b22639ed1e400eaec1b1cb94ff3b216cf3c3.scope"},
-		ParentPid:    10884,
-		StartTime:    stime,
-		EffectiveUID: 1000,
+		Name:            "process-exporte",
+		Cmdline:         []string{"./process-exporter", "-procnames", "bash"},
+		Cgroups:         []string{"/system.slice/docker-8dde0b0d6e919baef8d635cd9399b22639ed1e400eaec1b1cb94ff3b216cf3c3.scope"},
+		ParentPid:       10884,
+		StartTime:       stime,
+		EffectiveUID:    1000,
+		TTY:             34834,
+		Session:         10884,
+		PGRP:            14804,
+		LoginUID:        1000,
+		SessionID:       3,
+		SecurityContext: "unconfined_u:unconfined_r:unconfined_t:s0-s0:c0.c1023",
+		Cgroup2:         "/system.slice/docker-8dde0b0d6e919baef8d635cd9399b22639ed1e400eaec1b1cb94ff3b216cf3c3.scope",
 	}
 	if diff := cmp.Diff(pii.Static, wantstatic); diff != "" {
 		t.Errorf("static differs: (-got +want)\n%s", diff)
@@ -82,11 +94,23 @@ func TestReadFixture(t *testing.T) {
 			MinorPageFaults:       0x643,
 			CtxSwitchVoluntary:    72,
 			CtxSwitchNonvoluntary: 6,
+			LogicalReadBytes:      1605958,
+			LogicalWriteBytes:     69,
+			ReadSyscalls:          5534,
+			WriteSyscalls:         1,
+			CPURunTime:            1.5,
+			CPUWaitTime:           0.25,
+			Timeslices:            42,
+			BlkIODelayTime:        0.02,
 		},
 		Memory: Memory{
 			ResidentBytes: 0x7b1000,
 			VirtualBytes:  0x1061000,
 			VmSwapBytes:   0x2800,
+			VmHWMBytes:    0x7b1000,
+			VmPTEBytes:    0xc000,
+			MapCount:      10,
+			MapCountLimit: 65530,
 		},
 		Filedesc: Filedesc{
 			Open:  5,
@@ -94,12 +118,99 @@ func TestReadFixture(t *testing.T) {
 		},
 		NumThreads: 7,
 		States:     States{Sleeping: 1},
+		Limits: Limits{
+			"cpu":        {RLimInfinity, 0.14},
+			"fsize":      {RLimInfinity, -1},
+			"data":       {RLimInfinity, 9956 * 1024},
+			"stack":      {8388608, 132 * 1024},
+			"core":       {0, -1},
+			"rss":        {RLimInfinity, 0x7b1000},
+			"nproc":      {31421, -1},
+			"nofile":     {1024, 5},
+			"memlock":    {65536, 0},
+			"as":         {RLimInfinity, 0x1061000},
+			"locks":      {RLimInfinity, -1},
+			"sigpending": {31421, 2},
+			"msgqueue":   {819200, -1},
+			"nice":       {0, -1},
+			"rtprio":     {0, -1},
+			"rttime":     {RLimInfinity, -1},
+		},
+		Sched: Sched{LastCPU: 4, CPUsAllowed: 8},
 	}
 	if diff := cmp.Diff(pii.Metrics, wantmetrics); diff != "" {
 		t.Errorf("metrics differs: (-got +want)\n%s", diff)
 	}
 }
 
+// Test that the memory details in smaps_rollup are read when asked for.
+func TestReadFixtureSMaps(t *testing.T) {
+	fs, err := NewFS("../fixtures", false)
+	noerr(t, err)
+	fs.GatherSMaps = true
+	procs := fs.AllProcs()
+	var pii IDInfo
+	count := 0
+	for procs.Next() {
+		count++
+		var err error
+		pii, err = procinfo(procs)
+		noerr(t, err)
+	}
+	err = procs.Close()
+	noerr(t, err)
+	if count != 1 {
+		t.Fatalf("got %d procs, want 1", count)
+	}
+
+	got := pii.Memory
+	want := Memory{
+		ProportionalBytes:     6912 * 1024,
+		ProportionalSwapBytes: 8 * 1024,
+		AnonHugePagesBytes:    2048 * 1024,
+		UniqueBytes:           (1732 + 5120) * 1024,
+	}
+	got.ResidentBytes, got.VirtualBytes, got.VmSwapBytes, got.VmHWMBytes, got.VmPTEBytes = 0, 0, 0, 0, 0
+	got.MapCount, got.MapCountLimit = 0, 0
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("memory differs: (-got +want)\n%s", diff)
+	}
+}
+
+func TestTTYName(t *testing.T) {
+	for tty, want := range map[int]string{
+		0:      "",
+		34834:  "pts/18",
+		0x401:  "tty1",
+		0x440:  "ttyS0",
+		0x8a00: "pts/512",
+	} {
+		if got := TTYName(tty); got != want {
+			t.Errorf("TTYName(%d): got %q, want %q", tty, got, want)
+		}
+	}
+}
+
+func TestFDType(t *testing.T) {
+	for target, want := range map[string]string{
+		"socket:[12345]":             "socket",
+		"pipe:[678]":                 "pipe",
+		"/var/log/syslog":            "file",
+		"/var/log/old.log (deleted)": "file",
+		"/dev/null":                  "device",
+		"anon_inode:[eventfd]":       "eventfd",
+		"anon_inode:[eventpoll]":     "epoll",
+		"anon_inode:[timerfd]":       "timerfd",
+		"anon_inode:inotify":         "inotify",
+		"anon_inode:[io_uring]":      "anon_inode",
+		"net:[4026531840]":           "other",
+	} {
+		if got := FDType(target); got != want {
+			t.Errorf("FDType(%q): got %q, want %q", target, got, want)
+		}
+	}
+}
+
 func noerr(t *testing.T, err error) {
 	if err != nil {
 		t.Fatalf("error: %v", err)
@@ -150,6 +261,137 @@ func TestAllProcs(t *testing.T) {
 	}
 }
 
+// Test that we find the ports we listen on.
+func TestListenPorts(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	noerr(t, err)
+	defer tcp.Close()
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	noerr(t, err)
+	defer udp.Close()
+
+	want := []int{tcp.Addr().(*net.TCPAddr).Port, udp.LocalAddr().(*net.UDPAddr).Port}
+	sort.Ints(want)
+	procs := allprocs("/proc")
+	got := procs.(PortSource).ListenPorts(os.Getpid())
+	noerr(t, procs.Close())
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("ports differ: (-got +want)\n%s", diff)
+	}
+}
+
+// Test that we find the deleted files we hold open.
+func TestDeletedFiles(t *testing.T) {
+	f, err := ioutil.TempFile("", "deleted")
+	noerr(t, err)
+	defer f.Close()
+	_, err = f.Write(make([]byte, 1000))
+	noerr(t, err)
+	noerr(t, os.Remove(f.Name()))
+
+	// Neither memfds nor deleted files on tmpfs hold disk space.
+	mfd, err := unix.MemfdCreate("deleted", 0)
+	noerr(t, err)
+	defer unix.Close(mfd)
+	noerr(t, unix.Ftruncate(mfd, 2000))
+	if shm, err := ioutil.TempFile("/dev/shm", "deleted"); err == nil {
+		defer shm.Close()
+		_, err = shm.Write(make([]byte, 3000))
+		noerr(t, err)
+		noerr(t, os.Remove(shm.Name()))
+	}
+
+	fs, err := NewFS("/proc", false)
+	noerr(t, err)
+	fs.GatherDeletedFiles = true
+	procs := fs.AllProcs()
+	sizes := make(map[uint64]bool)
+	for procs.Next() {
+		if procs.GetPid() != os.Getpid() {
+			continue
+		}
+		metrics, _, err := procs.GetMetrics()
+		noerr(t, err)
+		for _, size := range metrics.Filedesc.Deleted {
+			sizes[size] = true
+		}
+	}
+	noerr(t, procs.Close())
+	if !sizes[1000] {
+		t.Errorf("didn't find deleted file of 1000 bytes")
+	}
+	if sizes[2000] || sizes[3000] {
+		t.Errorf("found memfd or tmpfs file among deleted files: %v", sizes)
+	}
+}
+
+// Test that network namespace traffic is only counted when the host's
+// network namespace can be told apart.
+func TestNetDev(t *testing.T) {
+	dir := t.TempDir()
+	noerr(t, os.MkdirAll(filepath.Join(dir, "5", "ns"), 0755))
+	noerr(t, os.MkdirAll(filepath.Join(dir, "5", "net"), 0755))
+	noerr(t, os.Symlink("net:[2]", filepath.Join(dir, "5", "ns", "net")))
+	noerr(t, os.WriteFile(filepath.Join(dir, "5", "net", "dev"), []byte(`Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:     100       1    0    0    0     0          0         0      100       1    0    0    0     0       0          0
+  eth0:    1000      10    0    1    0     0          0         0     2000      20    0    2    0     0       0          0
+`), 0644))
+
+	fs := &FS{MountPoint: dir}
+	if netns, counts := newPortScanner(fs).NetDev(5); netns != "" || counts != (Counts{}) {
+		t.Errorf("without the host's namespace: got %q %+v, want nothing", netns, counts)
+	}
+
+	noerr(t, os.MkdirAll(filepath.Join(dir, "1", "ns"), 0755))
+	noerr(t, os.Symlink("net:[1]", filepath.Join(dir, "1", "ns", "net")))
+	netns, counts := newPortScanner(fs).NetDev(5)
+	want := Counts{NetRxBytes: 1000, NetTxBytes: 2000, NetRxPackets: 10, NetTxPackets: 20, NetRxDrops: 1, NetTxDrops: 2}
+	if netns != "net:[2]" || counts != want {
+		t.Errorf("got %q %+v, want net:[2] %+v", netns, counts, want)
+	}
+	if netns, _ := newPortScanner(fs).NetDev(1); netns != "" {
+		t.Errorf("got %q for the host's namespace, want nothing", netns)
+	}
+}
+
+// Test that we find our sockets and their states.
+func TestSockets(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	noerr(t, err)
+	defer ln.Close()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	noerr(t, err)
+	defer conn.Close()
+	accepted, err := ln.Accept()
+	noerr(t, err)
+	defer accepted.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	fs, err := NewFS("/proc", false)
+	noerr(t, err)
+	fs.GatherSockets = true
+	procs := fs.AllProcs()
+	got := make(map[string]int)
+	for procs.Next() {
+		if procs.GetPid() != os.Getpid() {
+			continue
+		}
+		metrics, _, err := procs.GetMetrics()
+		noerr(t, err)
+		for _, sock := range metrics.Filedesc.Sockets {
+			if sock.Proto == "tcp" && sock.LocalPort == port {
+				got[sock.State]++
+			}
+		}
+	}
+	noerr(t, procs.Close())
+	want := map[string]int{"LISTEN": 1, "ESTABLISHED": 1}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("sockets differ: (-got +want)\n%s", diff)
+	}
+}
+
 // Test that we can observe the absence of a child process before it spawns and after it exits,
 // and its presence during its lifetime.
 func TestAllProcsSpawn(t *testing.T) {
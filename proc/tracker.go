@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os/user"
+	"sort"
 	"strconv"
 	"time"
 
@@ -11,6 +12,11 @@ import (
 	common "github.com/ncabatoff/process-exporter"
 )
 
+// listenGracePeriod is how long after they start unmatched procs are matched
+// again when listening_port rules exist, as a service may take a while to
+// bind its ports.
+const listenGracePeriod = time.Minute
+
 type (
 	// Tracker tracks processes and records metrics.
 	Tracker struct {
@@ -18,7 +24,8 @@ type (
 		namer common.MatchNamer
 		// tracked holds the processes are being monitored.  Processes
 		// may be blacklisted such that they no longer get tracked by
-		// setting their value in the tracked map to nil.
+		// setting their value in the tracked map to nil, or kept pending
+		// until an age-based rule may match them.
 		tracked map[ID]*trackedProc
 		// procIds is a map from pid to ProcId.  This is a convenience
 		// to allow finding the Tracked entry of a parent process.
@@ -33,8 +40,23 @@ type (
 		recheck bool
 		// limit rechecks to this much time
 		recheckTimeLimit time.Duration
-		username         map[int]string
-		debug            bool
+		// ageRules is true if the namer has rules that select procs by age,
+		// in which case procs are matched again at the ages of those rules.
+		ageRules bool
+		// usageRules is true if the namer has rules that select procs by
+		// resource usage, in which case unmatched procs are kept pending.
+		usageRules bool
+		// portRules is true if the namer has rules that select procs by
+		// the ports they listen on, in which case unmatched procs are
+		// matched again until they're listenGracePeriod old.
+		portRules bool
+		// ports finds the ports procs listen on during the current update,
+		// if the Iter it's given can.
+		ports PortSource
+		// pidfilePids holds the PIDs found in pidfiles during the last update.
+		pidfilePids map[int]struct{}
+		username    map[int]string
+		debug       bool
 	}
 
 	// Delta is an alias of Counts used to signal that its contents are not
@@ -47,6 +69,7 @@ type (
 		latest     Delta
 		lastUpdate time.Time
 		wchan      string
+		sched      Sched
 	}
 
 	// trackedProc accumulates metrics for a process, as well as
@@ -61,7 +84,33 @@ type (
 		lastaccum Delta
 		// groupName is the tag for this proc given by the namer.
 		groupName string
-		threads   map[ThreadID]trackedThread
+		// rule is the rule that named this proc, or nil if the namer has no rules.
+		rule common.Rule
+		// inherited is true if the proc was tracked because of its ancestry.
+		inherited bool
+		// usageHeld is true if the proc was tracked because of its resource
+		// usage, meaning rule must be checked again every cycle.
+		usageHeld bool
+		// interval is the time between the last two updates, or zero if
+		// there haven't been two yet.
+		interval time.Duration
+		// pending is true if the proc isn't part of any group, but is kept
+		// until recheckAt in case an age-based rule matches it then.
+		pending bool
+		// recheckAt is when the proc must be matched again because its
+		// age crosses a threshold of an age-based rule, or zero if never.
+		recheckAt time.Time
+		// awaitParent is true if the proc is pending because its parent
+		// is, so that it's tracked as a child if its parent gets tracked.
+		awaitParent bool
+		// stale is true if metrics weren't read on the last update because
+		// the proc was pending, see handleProc.
+		stale   bool
+		threads map[ThreadID]trackedThread
+		// netns is the network namespace whose traffic is counted in this
+		// proc, see Tracker.ownNetNS, and netdev that traffic.
+		netns  string
+		netdev Counts
 	}
 
 	// ThreadUpdate describes what's changed for a thread since the last cycle.
@@ -93,6 +142,20 @@ type (
 		// Threads are the thread updates for this process, if the Tracker
 		// has trackThreads==true.
 		Threads []ThreadUpdate
+		// Metadata is the metadata of the rule that named the process.
+		Metadata map[string]string
+		// Limits are the current resource limits and usage.
+		Limits
+		// LastCPUs is how many threads last ran on each CPU.
+		LastCPUs map[int]int
+		// CPUsAllowed is the number of CPUs the process may run on.
+		CPUsAllowed int
+		// SchedPolicies and Nices are how many threads have each
+		// scheduling policy and nice value.
+		SchedPolicies map[int]int
+		Nices         map[int]int
+		// Cgroup2 is the cgroup v2 path of the process.
+		Cgroup2 string
 	}
 
 	// CollectErrors describes non-fatal errors found while collecting proc
@@ -117,14 +180,23 @@ func lessCounts(x, y Counts) bool { return seq.Compare(x, y) < 0 }
 
 func (tp *trackedProc) getUpdate() Update {
 	u := Update{
-		GroupName:  tp.groupName,
-		Latest:     tp.lastaccum,
-		Memory:     tp.metrics.Memory,
-		Filedesc:   tp.metrics.Filedesc,
-		Start:      tp.static.StartTime,
-		NumThreads: tp.metrics.NumThreads,
-		States:     tp.metrics.States,
-		Wchans:     make(map[string]int),
+		GroupName:     tp.groupName,
+		Latest:        tp.lastaccum,
+		Memory:        tp.metrics.Memory,
+		Filedesc:      tp.metrics.Filedesc,
+		Start:         tp.static.StartTime,
+		NumThreads:    tp.metrics.NumThreads,
+		States:        tp.metrics.States,
+		Wchans:        make(map[string]int),
+		Limits:        tp.metrics.Limits,
+		LastCPUs:      make(map[int]int),
+		CPUsAllowed:   tp.metrics.CPUsAllowed,
+		SchedPolicies: make(map[int]int),
+		Nices:         make(map[int]int),
+		Cgroup2:       tp.static.Cgroup2,
+	}
+	if tp.rule != nil {
+		u.Metadata = tp.rule.Metadata()
 	}
 	if tp.metrics.Wchan != "" {
 		u.Wchans[tp.metrics.Wchan] = 1
@@ -135,13 +207,26 @@ func (tp *trackedProc) getUpdate() Update {
 			if tt.wchan != "" {
 				u.Wchans[tt.wchan]++
 			}
+			u.LastCPUs[tt.sched.LastCPU]++
+			u.SchedPolicies[tt.sched.Policy]++
+			u.Nices[tt.sched.Nice]++
 		}
+	} else {
+		u.LastCPUs[tp.metrics.LastCPU] = 1
+		u.SchedPolicies[tp.metrics.Policy] = 1
+		u.Nices[tp.metrics.Nice] = 1
 	}
 	return u
 }
 
 // NewTracker creates a Tracker.
 func NewTracker(namer common.MatchNamer, trackChildren bool, recheck bool, recheckTimeLimit time.Duration, debug bool) *Tracker {
+	var ageRules, usageRules, portRules bool
+	if rn, ok := namer.(common.RuleMatchNamer); ok {
+		ageRules = rn.HasAgeRules()
+		usageRules = rn.HasUsageRules()
+		portRules = rn.HasPortRules()
+	}
 	return &Tracker{
 		namer:            namer,
 		tracked:          make(map[ID]*trackedProc),
@@ -149,22 +234,27 @@ func NewTracker(namer common.MatchNamer, trackChildren bool, recheck bool, reche
 		trackChildren:    trackChildren,
 		recheck:          recheck,
 		recheckTimeLimit: recheckTimeLimit,
+		ageRules:         ageRules,
+		usageRules:       usageRules,
+		portRules:        portRules,
 		username:         make(map[int]string),
 		debug:            debug,
 	}
 }
 
-func (t *Tracker) track(groupName string, idinfo IDInfo) {
+func (t *Tracker) track(groupName string, rule common.Rule, idinfo IDInfo) {
 	tproc := trackedProc{
 		groupName: groupName,
+		rule:      rule,
 		static:    idinfo.Static,
 		metrics:   idinfo.Metrics,
+		recheckAt: t.nextAgeRecheck(idinfo, time.Now()),
 	}
 	if len(idinfo.Threads) > 0 {
 		tproc.threads = make(map[ThreadID]trackedThread)
 		for _, thr := range idinfo.Threads {
 			tproc.threads[thr.ThreadID] = trackedThread{
-				thr.ThreadName, thr.Counts, Delta{}, time.Time{}, thr.Wchan}
+				thr.ThreadName, thr.Counts, Delta{}, time.Time{}, thr.Wchan, thr.Sched}
 		}
 	}
 
@@ -177,38 +267,209 @@ func (t *Tracker) track(groupName string, idinfo IDInfo) {
 	t.tracked[idinfo.ID] = &tproc
 }
 
-func (t *Tracker) ignore(id ID, startTime time.Time) {
+func (t *Tracker) ignore(idinfo IDInfo) {
 	// only ignore ID if we didn't set recheck to true
 	if t.recheck {
 		if t.recheckTimeLimit == 0 {
 			// plain -recheck with no time limit:
 			return
 		}
-		if startTime.Add(t.recheckTimeLimit).After(time.Now()) {
+		if idinfo.StartTime.Add(t.recheckTimeLimit).After(time.Now()) {
 			// -recheckWithTimeLimit is used and the limit is not reached yet:
 			return
 		}
 	}
-	t.tracked[id] = nil
+	// A listening_port rule may match the proc once it has bound its
+	// port, so leave it unknown to be matched again for a while.
+	if t.portRules && idinfo.StartTime.Add(listenGracePeriod).After(time.Now()) {
+		return
+	}
+	// An age-based rule may match the proc once it's older, or a
+	// usage-based rule once it uses more resources, so keep it pending.
+	if recheckAt := t.nextAgeRecheck(idinfo, time.Now()); !recheckAt.IsZero() || t.usageRules {
+		t.tracked[idinfo.ID] = &trackedProc{
+			static:    idinfo.Static,
+			metrics:   idinfo.Metrics,
+			pending:   true,
+			recheckAt: recheckAt,
+		}
+		return
+	}
+	t.tracked[idinfo.ID] = nil
+}
+
+// refreshPidfiles rereads the pidfiles of pidfile-based rules.  Known procs
+// whose PID was added to or removed from a pidfile must be matched again:
+// ignored ones are forgotten so that they're found anew, others get
+// rechecked along with those that aged.
+func (t *Tracker) refreshPidfiles(rn common.RuleMatchNamer) {
+	pids := make(map[int]struct{})
+	for _, pid := range rn.RefreshPidfiles() {
+		pids[pid] = struct{}{}
+	}
+	recheck := func(pid int) {
+		id, ok := t.procIds[pid]
+		if !ok {
+			return
+		}
+		tproc, ok := t.tracked[id]
+		switch {
+		case !ok:
+		case tproc == nil:
+			delete(t.tracked, id)
+		default:
+			tproc.recheckAt = time.Now()
+		}
+	}
+	var added bool
+	for pid := range pids {
+		if _, ok := t.pidfilePids[pid]; !ok {
+			recheck(pid)
+			added = true
+		}
+	}
+	for pid := range t.pidfilePids {
+		if _, ok := pids[pid]; !ok {
+			recheck(pid)
+		}
+	}
+	t.pidfilePids = pids
+
+	// The descendants of a proc whose PID was added may have been ignored
+	// while it wasn't tracked, e.g. because it hadn't written its pidfile
+	// yet.  Ignored procs don't record their parent, so forget them all
+	// for them to be found anew.
+	if added {
+		for id, tproc := range t.tracked {
+			if tproc == nil {
+				delete(t.tracked, id)
+			}
+		}
+	}
+}
+
+// nextAgeRecheck returns the first time after now at which idinfo reaches
+// the age of an age-based rule that may match it, or zero if none remain.
+func (t *Tracker) nextAgeRecheck(idinfo IDInfo, now time.Time) time.Time {
+	if !t.ageRules {
+		return time.Time{}
+	}
+	for _, th := range t.namer.(common.RuleMatchNamer).AgeThresholds(t.procAttributes(idinfo)) {
+		if at := idinfo.StartTime.Add(th); at.After(now) {
+			return at
+		}
+	}
+	return time.Time{}
+}
+
+// recheckAge matches tp again because its age crossed a threshold of an
+// age-based rule since it was last matched, or a pidfile changed.
+func (t *Tracker) recheckAge(id ID, tp *trackedProc, now time.Time) {
+	wanted, gname, rule := t.matchAndName(t.procAttributes(IDInfo{ID: id, Static: tp.static}))
+	tp.recheckAt = t.nextAgeRecheck(IDInfo{ID: id, Static: tp.static}, now)
+	switch {
+	case wanted:
+		if t.debug && gname != tp.groupName {
+			log.Printf("matched as %q after aging: %+v", gname, tp.static)
+		}
+		tp.groupName, tp.rule = gname, rule
+		tp.inherited, tp.usageHeld, tp.pending, tp.awaitParent = false, false, false, false
+	case tp.inherited, tp.usageHeld:
+		// Still part of its ancestor's group, or left to the usage-based rules.
+	case tp.recheckAt.IsZero() && !t.usageRules && !tp.awaitParent:
+		t.tracked[id] = nil
+	default:
+		tp.groupName, tp.rule, tp.pending = "", nil, true
+	}
+	if t.tracked[id] == nil || !tp.pending {
+		t.adoptChildren(id)
+	}
+}
+
+// adoptChildren matches again the children of pid that were kept pending
+// because it was, now that it's tracked or ignored, and so on down the
+// process tree.
+func (t *Tracker) adoptChildren(pid ID) {
+	ptproc := t.tracked[pid]
+	if ptproc != nil && ptproc.pending {
+		return
+	}
+	for id, tp := range t.tracked {
+		if tp == nil || !tp.awaitParent || tp.static.ParentPid != pid.Pid {
+			continue
+		}
+		idinfo := IDInfo{ID: id, Static: tp.static, Metrics: tp.metrics}
+		if ptproc == nil {
+			t.ignoreUnmatched(idinfo)
+		} else if t.trackChild(ptproc, pid, idinfo) != "" {
+			// It's been seen before, so only count what it used since.
+			ctp := t.tracked[id]
+			ctp.lastaccum, ctp.lastUpdate, ctp.interval, ctp.threads = tp.lastaccum, tp.lastUpdate, tp.interval, tp.threads
+			ctp.stale = tp.stale
+		} else if t.tracked[id] == tp {
+			t.ignore(idinfo)
+		}
+		t.adoptChildren(id)
+	}
+}
+
+// releaseChildren makes the procs that were tracked because of their
+// ancestry wait for pid, which is no longer tracked, to be tracked again,
+// and so on down the process tree.
+func (t *Tracker) releaseChildren(pid ID) {
+	for id, tp := range t.tracked {
+		if tp == nil || !tp.inherited || tp.static.ParentPid != pid.Pid {
+			continue
+		}
+		if t.debug {
+			log.Printf("released from %q with its parent %+v: %+v", tp.groupName, pid, tp.static)
+		}
+		tp.groupName, tp.rule = "", nil
+		tp.inherited, tp.pending, tp.awaitParent = false, true, true
+		t.releaseChildren(id)
+	}
 }
 
 func (tp *trackedProc) update(metrics Metrics, now time.Time, cerrs *CollectErrors, threads []Thread) {
 	// newcounts: resource consumption since last cycle
 	newcounts := metrics.Counts
 	tp.lastaccum = newcounts.Sub(tp.metrics.Counts)
+	if tp.stale {
+		// Only count from when the proc was tracked.
+		tp.lastaccum, tp.stale = Delta{}, false
+	}
 	tp.metrics = metrics
+	if !tp.lastUpdate.IsZero() {
+		tp.interval = now.Sub(tp.lastUpdate)
+	}
 	tp.lastUpdate = now
-	if len(threads) > 1 {
-		if tp.threads == nil {
+	if len(threads) > 0 {
+		// The scheduler and delay accounting stats are summed over threads,
+		// so the process total drops when a thread exits.  Instead add up
+		// the increments of each thread, counting new ones in full, once we
+		// know the threads.
+		known := tp.threads != nil
+		if !known {
 			tp.threads = make(map[ThreadID]trackedThread)
 		}
+		var sched Delta
 		for _, thr := range threads {
-			tt := trackedThread{thr.ThreadName, thr.Counts, Delta{}, now, thr.Wchan}
+			tt := trackedThread{thr.ThreadName, thr.Counts, Delta{}, now, thr.Wchan, thr.Sched}
+			delta := Delta(thr.Counts)
 			if old, ok := tp.threads[thr.ThreadID]; ok {
-				tt.latest, tt.accum = thr.Counts.Sub(old.accum), thr.Counts
+				delta = thr.Counts.Sub(old.accum)
+				tt.latest = delta
 			}
+			sched.CPURunTime += delta.CPURunTime
+			sched.CPUWaitTime += delta.CPUWaitTime
+			sched.Timeslices += delta.Timeslices
+			sched.BlkIODelayTime += delta.BlkIODelayTime
 			tp.threads[thr.ThreadID] = tt
 		}
+		if known {
+			tp.lastaccum.CPURunTime, tp.lastaccum.CPUWaitTime = sched.CPURunTime, sched.CPUWaitTime
+			tp.lastaccum.Timeslices, tp.lastaccum.BlkIODelayTime = sched.Timeslices, sched.BlkIODelayTime
+		}
 		for id, tt := range tp.threads {
 			if tt.lastUpdate != now {
 				delete(tp.threads, id)
@@ -239,6 +500,12 @@ func (t *Tracker) handleProc(proc Proc, updateTime time.Time) (*IDInfo, CollectE
 	if known && last == nil {
 		return nil, cerrs
 	}
+	// Nor read the metrics of a proc that's pending until an age-based
+	// rule or its parent decide, as only usage-based rules need them.
+	if known && last.pending && !t.usageRules {
+		last.lastUpdate, last.interval, last.threads, last.stale = updateTime, 0, nil, true
+		return nil, cerrs
+	}
 
 	metrics, softerrors, err := proc.GetMetrics()
 	if err != nil {
@@ -265,9 +532,15 @@ func (t *Tracker) handleProc(proc Proc, updateTime time.Time) (*IDInfo, CollectE
 
 	if len(threads) > 0 {
 		metrics.Counts.CtxSwitchNonvoluntary, metrics.Counts.CtxSwitchVoluntary = 0, 0
+		metrics.Counts.CPURunTime, metrics.Counts.CPUWaitTime, metrics.Counts.Timeslices = 0, 0, 0
+		metrics.Counts.BlkIODelayTime = 0
 		for _, thread := range threads {
 			metrics.Counts.CtxSwitchNonvoluntary += thread.Counts.CtxSwitchNonvoluntary
 			metrics.Counts.CtxSwitchVoluntary += thread.Counts.CtxSwitchVoluntary
+			metrics.Counts.CPURunTime += thread.Counts.CPURunTime
+			metrics.Counts.CPUWaitTime += thread.Counts.CPUWaitTime
+			metrics.Counts.Timeslices += thread.Counts.Timeslices
+			metrics.Counts.BlkIODelayTime += thread.Counts.BlkIODelayTime
 			metrics.States.Add(thread.States)
 		}
 	}
@@ -342,57 +615,257 @@ func (t *Tracker) update(procs Iter) ([]IDInfo, CollectErrors, error) {
 
 // checkAncestry walks the process tree recursively towards the root,
 // stopping at pid 1 or upon finding a parent that's already tracked
-// or ignored.  If we find a tracked parent track this one too; if not,
-// ignore this one.
+// or ignored.  If we find a tracked parent track this one too, as its
+// rule dictates; if not, ignore this one.
 func (t *Tracker) checkAncestry(idinfo IDInfo, newprocs map[ID]IDInfo) string {
 	ppid := idinfo.ParentPid
 	pProcID := t.procIds[ppid]
 	if pProcID.Pid < 1 {
-		if t.debug {
-			log.Printf("ignoring unmatched proc with no matched parent: %+v", idinfo)
-		}
 		// Reached root of process tree without finding a tracked parent.
-		t.ignore(idinfo.ID, idinfo.Static.StartTime)
+		t.ignoreUnmatched(idinfo)
 		return ""
 	}
 
 	// Is the parent already known to the tracker?
 	if ptproc, ok := t.tracked[pProcID]; ok {
-		if ptproc != nil {
-			if t.debug {
-				log.Printf("matched as %q because child of %+v: %+v",
-					ptproc.groupName, pProcID, idinfo)
-			}
+		switch {
+		case ptproc == nil:
+			// We've found an untracked parent.
+			t.ignoreUnmatched(idinfo)
+		case ptproc.pending:
+			// The parent may be tracked later, see adoptChildren.
+			t.awaitParent(idinfo)
+		default:
 			// We've found a tracked parent.
-			t.track(ptproc.groupName, idinfo)
-			return ptproc.groupName
+			return t.trackChild(ptproc, pProcID, idinfo)
 		}
-		// We've found an untracked parent.
-		t.ignore(idinfo.ID, idinfo.Static.StartTime)
 		return ""
 	}
 
 	// Is the parent another new process?
 	if pinfoid, ok := newprocs[pProcID]; ok {
 		if name := t.checkAncestry(pinfoid, newprocs); name != "" {
-			if t.debug {
-				log.Printf("matched as %q because child of %+v: %+v",
-					name, pProcID, idinfo)
-			}
 			// We've found a tracked parent, which implies this entire lineage should be tracked.
-			t.track(name, idinfo)
-			return name
+			return t.trackChild(t.tracked[pProcID], pProcID, idinfo)
+		}
+		if ptproc := t.tracked[pProcID]; ptproc != nil && ptproc.pending {
+			t.awaitParent(idinfo)
+			return ""
 		}
 	}
 
 	// Parent is dead, i.e. we never saw it, or there's no tracked proc in our ancestry.
+	t.ignoreUnmatched(idinfo)
+	return ""
+}
+
+// ignoreUnmatched ignores idinfo, an unmatched proc without a tracked
+// parent.  Without -children, such procs are left unknown instead so
+// that they get matched again next cycle, as they always have been.
+func (t *Tracker) ignoreUnmatched(idinfo IDInfo) {
+	if !t.trackChildren {
+		return
+	}
 	if t.debug {
 		log.Printf("ignoring unmatched proc with no matched parent: %+v", idinfo)
 	}
-	t.ignore(idinfo.ID, idinfo.Static.StartTime)
+	t.ignore(idinfo)
+}
+
+// awaitParent keeps idinfo, an unmatched proc whose parent is pending,
+// pending too until its parent is tracked or ignored.  Like ignoreUnmatched,
+// it leaves the proc unknown without -children.
+func (t *Tracker) awaitParent(idinfo IDInfo) {
+	if !t.trackChildren {
+		return
+	}
+	t.tracked[idinfo.ID] = &trackedProc{
+		static:      idinfo.Static,
+		metrics:     idinfo.Metrics,
+		pending:     true,
+		recheckAt:   t.nextAgeRecheck(idinfo, time.Now()),
+		awaitParent: true,
+	}
+}
+
+// trackChild tracks or ignores idinfo, an unmatched proc whose parent
+// ptproc is tracked, as the parent's rule says.  Returns the group name
+// idinfo was given, or "" if it wasn't tracked.
+func (t *Tracker) trackChild(ptproc *trackedProc, pProcID ID, idinfo IDInfo) string {
+	mode, name := common.ChildDefault, ""
+	if rn, ok := t.namer.(common.RuleMatchNamer); ok {
+		nacl := t.procAttributes(idinfo)
+		if rn.ExcludeChild(nacl) {
+			if t.debug {
+				log.Printf("ignoring excluded child of %+v: %+v", pProcID, idinfo)
+			}
+			t.ignore(idinfo)
+			return ""
+		}
+		if ptproc.rule != nil {
+			mode, name = ptproc.rule.ChildGroup(ptproc.groupName, nacl)
+		}
+	}
+	if mode == common.ChildDefault {
+		if !t.trackChildren {
+			return ""
+		}
+		mode = common.ChildInherit
+	}
+
+	switch mode {
+	case common.ChildInherit:
+		if t.debug {
+			log.Printf("matched as %q because child of %+v: %+v",
+				ptproc.groupName, pProcID, idinfo)
+		}
+		t.track(ptproc.groupName, ptproc.rule, idinfo)
+		t.tracked[idinfo.ID].inherited = true
+		return ptproc.groupName
+	case common.ChildSeparate:
+		if t.debug {
+			log.Printf("matched as %q because separated child of %+v: %+v",
+				name, pProcID, idinfo)
+		}
+		// The child's own descendants join its group rather than being
+		// separated again.
+		t.track(name, inheritRule{ptproc.rule}, idinfo)
+		t.tracked[idinfo.ID].inherited = true
+		return name
+	}
+
+	if t.debug {
+		log.Printf("ignoring child of %+v as its rule says: %+v", pProcID, idinfo)
+	}
+	t.ignore(idinfo)
 	return ""
 }
 
+// usage returns the resource usage of tp over the last cycle, or over its
+// lifetime if it hasn't been updated twice yet.
+func (tp *trackedProc) usage(now time.Time) common.Usage {
+	if tp.interval == 0 {
+		return lifetimeUsage(tp.static, tp.metrics, now)
+	}
+	cpu := tp.lastaccum.CPUUserTime + tp.lastaccum.CPUSystemTime
+	return common.Usage{
+		ResidentBytes: tp.metrics.ResidentBytes,
+		CPURatio:      cpu / tp.interval.Seconds(),
+	}
+}
+
+// lifetimeUsage returns the resource usage of a proc averaged since it started.
+func lifetimeUsage(static Static, metrics Metrics, now time.Time) common.Usage {
+	u := common.Usage{ResidentBytes: metrics.ResidentBytes}
+	if age := now.Sub(static.StartTime).Seconds(); age > 0 {
+		u.CPURatio = (metrics.CPUUserTime + metrics.CPUSystemTime) / age
+	}
+	return u
+}
+
+// matchUsage applies the usage-based rules to procs no other rule wants,
+// and to those they matched before, which they may now release.
+func (t *Tracker) matchUsage(newProcs []IDInfo, now time.Time) {
+	rn := t.namer.(common.RuleMatchNamer)
+	for id, tproc := range t.tracked {
+		if tproc == nil || !(tproc.pending || tproc.usageHeld) {
+			continue
+		}
+		var held common.Rule
+		if tproc.usageHeld {
+			held = tproc.rule
+		}
+		nacl := t.procAttributes(IDInfo{ID: id, Static: tproc.static})
+		wanted, gname, rule := rn.MatchAndNameUsage(nacl, tproc.usage(now), held)
+		switch {
+		case wanted:
+			if t.debug && gname != tproc.groupName {
+				log.Printf("matched as %q because of resource usage: %+v", gname, tproc.static)
+			}
+			tproc.groupName, tproc.rule = gname, rule
+			tproc.usageHeld, tproc.pending, tproc.inherited, tproc.awaitParent = true, false, false, false
+			t.adoptChildren(id)
+		case tproc.usageHeld:
+			if t.debug {
+				log.Printf("released from %q because of resource usage: %+v", tproc.groupName, tproc.static)
+			}
+			tproc.groupName, tproc.rule = "", nil
+			tproc.usageHeld, tproc.pending = false, true
+			t.releaseChildren(id)
+		}
+	}
+
+	// Procs that are neither tracked nor pending, e.g. due to -recheck,
+	// only have their lifetime usage to go by.
+	for _, idinfo := range newProcs {
+		if _, ok := t.tracked[idinfo.ID]; ok {
+			continue
+		}
+		nacl := t.procAttributes(idinfo)
+		wanted, gname, rule := rn.MatchAndNameUsage(nacl, lifetimeUsage(idinfo.Static, idinfo.Metrics, now), nil)
+		if wanted {
+			if t.debug {
+				log.Printf("matched as %q because of resource usage: %+v", gname, idinfo)
+			}
+			t.track(gname, rule, idinfo)
+			t.tracked[idinfo.ID].usageHeld = true
+		}
+	}
+}
+
+// inheritRule wraps the rule of a proc whose children are tracked in
+// groups of their own, so that their descendants are added to those groups.
+type inheritRule struct {
+	common.Rule
+}
+
+// ChildGroup implements common.Rule.
+func (inheritRule) ChildGroup(string, common.ProcAttributes) (common.ChildMode, string) {
+	return common.ChildInherit, ""
+}
+
+// matchAndName applies the namer to nacl, returning the matching rule as
+// well when the namer supports it.
+func (t *Tracker) matchAndName(nacl common.ProcAttributes) (bool, string, common.Rule) {
+	if rn, ok := t.namer.(common.RuleMatchNamer); ok {
+		return rn.MatchAndNameRule(nacl)
+	}
+	wanted, gname := t.namer.MatchAndName(nacl)
+	return wanted, gname, nil
+}
+
+func (t *Tracker) procAttributes(idinfo IDInfo) common.ProcAttributes {
+	nacl := common.ProcAttributes{
+		Name:            idinfo.Name,
+		Cmdline:         idinfo.Cmdline,
+		Cgroups:         idinfo.Cgroups,
+		Username:        t.lookupUid(idinfo.EffectiveUID),
+		PID:             idinfo.Pid,
+		StartTime:       idinfo.StartTime,
+		TTY:             TTYName(idinfo.TTY),
+		Session:         idinfo.Session,
+		PGRP:            idinfo.PGRP,
+		SessionID:       idinfo.SessionID,
+		SecurityContext: idinfo.SecurityContext,
+	}
+	if idinfo.LoginUID != -1 {
+		nacl.LoginUser = t.lookupUid(idinfo.LoginUID)
+	}
+	if ports := t.ports; ports != nil {
+		var (
+			scanned bool
+			listen  []int
+		)
+		nacl.ListenPorts = func() []int {
+			if !scanned {
+				listen, scanned = ports.ListenPorts(idinfo.Pid), true
+			}
+			return listen
+		}
+	}
+	return nacl
+}
+
 func (t *Tracker) lookupUid(uid int) string {
 	if name, ok := t.username[uid]; ok {
 		return name
@@ -410,6 +883,42 @@ func (t *Tracker) lookupUid(uid int) string {
 	return name
 }
 
+// ownNetNS attributes the traffic of each network namespace other than the
+// host's to the tracked proc with the lowest pid in it, so that it's counted
+// once, and not lost to a proc we don't track.  Traffic only counts while a
+// proc owns the same namespace, and interfaces may go away.
+func (t *Tracker) ownNetNS(src NetNSSource) {
+	var ids []ID
+	for id, tproc := range t.tracked {
+		if tproc != nil && !tproc.pending {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Pid < ids[j].Pid })
+
+	owned := make(map[string]struct{})
+	for _, id := range ids {
+		tproc := t.tracked[id]
+		netns, netdev := src.NetDev(id.Pid)
+		if _, ok := owned[netns]; ok || netns == "" {
+			netns, netdev = "", Counts{}
+		}
+		owned[netns] = struct{}{}
+
+		old := tproc.netdev
+		if netns != "" && netns == tproc.netns && netdev.NetRxBytes >= old.NetRxBytes &&
+			netdev.NetTxBytes >= old.NetTxBytes && netdev.NetRxPackets >= old.NetRxPackets &&
+			netdev.NetTxPackets >= old.NetTxPackets && netdev.NetRxDrops >= old.NetRxDrops &&
+			netdev.NetTxDrops >= old.NetTxDrops {
+			delta := netdev.Sub(old)
+			tproc.lastaccum.NetRxBytes, tproc.lastaccum.NetTxBytes = delta.NetRxBytes, delta.NetTxBytes
+			tproc.lastaccum.NetRxPackets, tproc.lastaccum.NetTxPackets = delta.NetRxPackets, delta.NetTxPackets
+			tproc.lastaccum.NetRxDrops, tproc.lastaccum.NetTxDrops = delta.NetRxDrops, delta.NetTxDrops
+		}
+		tproc.netns, tproc.netdev = netns, netdev
+	}
+}
+
 // Update modifies the tracker's internal state based on what it reads from
 // iter.  Tracks any new procs the namer wants tracked, and updates
 // its metrics for existing tracked procs.  Returns nonfatal errors
@@ -419,35 +928,42 @@ func (t *Tracker) Update(iter Iter) (CollectErrors, []Update, error) {
 		t.firstUpdateAt = time.Now()
 	}
 
+	if rn, ok := t.namer.(common.RuleMatchNamer); ok {
+		t.refreshPidfiles(rn)
+	}
+
+	t.ports, _ = iter.(PortSource)
 	newProcs, colErrs, err := t.update(iter)
 	if err != nil {
 		return colErrs, nil, err
 	}
 
+	// Step 0: match again any known proc whose age crossed a threshold of an age-based rule,
+	// or whose PID was added to or removed from a pidfile.
+	now := time.Now()
+	for id, tproc := range t.tracked {
+		if tproc != nil && !tproc.recheckAt.IsZero() && !now.Before(tproc.recheckAt) {
+			t.recheckAge(id, tproc, now)
+		}
+	}
+
 	// Step 1: track any new proc that should be tracked based on its name and cmdline.
 	untracked := make(map[ID]IDInfo)
 	for _, idinfo := range newProcs {
-		nacl := common.ProcAttributes{
-			Name:      idinfo.Name,
-			Cmdline:   idinfo.Cmdline,
-			Cgroups:   idinfo.Cgroups,
-			Username:  t.lookupUid(idinfo.EffectiveUID),
-			PID:       idinfo.Pid,
-			StartTime: idinfo.StartTime,
-		}
-		wanted, gname := t.namer.MatchAndName(nacl)
+		wanted, gname, rule := t.matchAndName(t.procAttributes(idinfo))
 		if wanted {
 			if t.debug {
 				log.Printf("matched as %q: %+v", gname, idinfo)
 			}
-			t.track(gname, idinfo)
+			t.track(gname, rule, idinfo)
 		} else {
 			untracked[idinfo.ID] = idinfo
 		}
 	}
 
 	// Step 2: track any untracked new proc that should be tracked because its parent is tracked.
-	if t.trackChildren {
+	// Rules may ask for that even without -children.
+	if _, ok := t.namer.(common.RuleMatchNamer); ok || t.trackChildren {
 		for _, idinfo := range untracked {
 			if _, ok := t.tracked[idinfo.ID]; ok {
 				// Already tracked or ignored in an earlier iteration
@@ -458,9 +974,20 @@ func (t *Tracker) Update(iter Iter) (CollectErrors, []Update, error) {
 		}
 	}
 
+	// Step 3: track any proc no rule wanted so far whose resource usage is high enough.
+	if t.usageRules {
+		t.matchUsage(newProcs, now)
+	}
+
+	// Step 4: attribute the traffic of network namespaces to the tracked procs.
+	if src, ok := iter.(NetNSSource); ok {
+		t.ownNetNS(src)
+	}
+
 	tp := []Update{}
 	for _, tproc := range t.tracked {
-		if tproc != nil {
+		// Procs whose metrics are stale join their group on the next update.
+		if tproc != nil && !tproc.pending && !tproc.stale {
 			tp = append(tp, tproc.getUpdate())
 		}
 	}
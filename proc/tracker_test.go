@@ -6,6 +6,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	common "github.com/ncabatoff/process-exporter"
 )
 
 // Verify that the tracker finds and tracks or ignores procs based on the
@@ -22,17 +23,17 @@ func TestTrackerBasic(t *testing.T) {
 	}{
 		{
 			[]IDInfo{newProcStart(p1, n1, 1), newProcStart(p3, n3, 1)},
-			[]Update{{GroupName: n1, Start: t1, Wchans: msi{}}},
+			[]Update{{GroupName: n1, Start: t1, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}}},
 		},
 		{
 			// p3 (ignored) has exited and p2 has appeared
 			[]IDInfo{newProcStart(p1, n1, 1), newProcStart(p2, n2, 2)},
-			[]Update{{GroupName: n1, Start: t1, Wchans: msi{}}, {GroupName: n2, Start: t2, Wchans: msi{}}},
+			[]Update{{GroupName: n1, Start: t1, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}}, {GroupName: n2, Start: t2, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}}},
 		},
 		{
 			// p1 has exited and a new proc with a new name has taken its pid
 			[]IDInfo{newProcStart(p1, n4, 3), newProcStart(p2, n2, 2)},
-			[]Update{{GroupName: n4, Start: t3, Wchans: msi{}}, {GroupName: n2, Start: t2, Wchans: msi{}}},
+			[]Update{{GroupName: n4, Start: t3, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}}, {GroupName: n2, Start: t2, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}}},
 		},
 	}
 	// Note that n3 should not be tracked according to our namer.
@@ -66,7 +67,7 @@ func TestTrackerChildren(t *testing.T) {
 				newProcParent(p1, n1, 0),
 				newProcParent(p2, n2, p1),
 			},
-			[]Update{{GroupName: n2, Start: t1, Wchans: msi{}}},
+			[]Update{{GroupName: n2, Start: t1, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}}},
 		},
 		{
 			[]IDInfo{
@@ -74,7 +75,7 @@ func TestTrackerChildren(t *testing.T) {
 				newProcParent(p2, n2, p1),
 				newProcParent(p3, n3, p2),
 			},
-			[]Update{{GroupName: n2, Start: t1, Wchans: msi{}}, {GroupName: n2, Start: t1, Wchans: msi{}}},
+			[]Update{{GroupName: n2, Start: t1, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}}, {GroupName: n2, Start: t1, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}}},
 		},
 	}
 	// Only n2 and children of n2s should be tracked
@@ -99,16 +100,37 @@ func TestTrackerMetrics(t *testing.T) {
 		want Update
 	}{
 		{
-			piinfost(p, n, Counts{1, 2, 3, 4, 5, 6, 0, 0}, Memory{7, 8, 0, 0, 0},
-				Filedesc{1, 10}, 9, States{Sleeping: 1}),
-			Update{n, Delta{}, Memory{7, 8, 0, 0, 0}, Filedesc{1, 10}, tm,
-				9, States{Sleeping: 1}, msi{}, nil},
+			piinfost(p, n, Counts{CPUUserTime: 1, CPUSystemTime: 2, ReadBytes: 3, WriteBytes: 4, MajorPageFaults: 5, MinorPageFaults: 6}, Memory{ResidentBytes: 7, VirtualBytes: 8},
+				Filedesc{Open: 1, Limit: 10}, 9, States{Sleeping: 1}),
+			Update{
+				GroupName:     n,
+				Memory:        Memory{ResidentBytes: 7, VirtualBytes: 8},
+				Filedesc:      Filedesc{Open: 1, Limit: 10},
+				Start:         tm,
+				NumThreads:    9,
+				States:        States{Sleeping: 1},
+				Wchans:        msi{},
+				LastCPUs:      mii{0: 1},
+				SchedPolicies: mii{0: 1},
+				Nices:         mii{0: 1},
+			},
 		},
 		{
-			piinfost(p, n, Counts{2, 3, 4, 5, 6, 7, 0, 0}, Memory{1, 2, 0, 0, 0},
-				Filedesc{2, 20}, 1, States{Running: 1}),
-			Update{n, Delta{1, 1, 1, 1, 1, 1, 0, 0}, Memory{1, 2, 0, 0, 0},
-				Filedesc{2, 20}, tm, 1, States{Running: 1}, msi{}, nil},
+			piinfost(p, n, Counts{CPUUserTime: 2, CPUSystemTime: 3, ReadBytes: 4, WriteBytes: 5, MajorPageFaults: 6, MinorPageFaults: 7}, Memory{ResidentBytes: 1, VirtualBytes: 2},
+				Filedesc{Open: 2, Limit: 20}, 1, States{Running: 1}),
+			Update{
+				GroupName:     n,
+				Latest:        Delta{CPUUserTime: 1, CPUSystemTime: 1, ReadBytes: 1, WriteBytes: 1, MajorPageFaults: 1, MinorPageFaults: 1},
+				Memory:        Memory{ResidentBytes: 1, VirtualBytes: 2},
+				Filedesc:      Filedesc{Open: 2, Limit: 20},
+				Start:         tm,
+				NumThreads:    1,
+				States:        States{Running: 1},
+				Wchans:        msi{},
+				LastCPUs:      mii{0: 1},
+				SchedPolicies: mii{0: 1},
+				Nices:         mii{0: 1},
+			},
 		},
 	}
 	tr := NewTracker(newNamer(n), false, false, 0, false)
@@ -122,6 +144,74 @@ func TestTrackerMetrics(t *testing.T) {
 	}
 }
 
+// netnsIter is an Iter that's also a NetNSSource.
+type netnsIter struct {
+	Iter
+	netns  map[int]string
+	netdev map[string]Counts
+}
+
+func (n netnsIter) NetDev(pid int) (string, Counts) {
+	netns := n.netns[pid]
+	return netns, n.netdev[netns]
+}
+
+// TestTrackerNetNS verifies that network namespace traffic is only
+// counted while a proc owns the same namespace, and that the tracked proc
+// with the lowest pid owns it even if an untracked one has a lower pid.
+func TestTrackerNetNS(t *testing.T) {
+	pause, p1, p2, n := 1, 2, 3, "g1"
+	// Start times are the pids, to tell the updates apart.
+	procs := []IDInfo{newProcStart(pause, "pause", 1), newProcStart(p1, n, 2), newProcStart(p2, n, 3)}
+
+	tests := []struct {
+		netns  map[int]string
+		netdev map[string]Counts
+		want   map[int]uint64
+	}{
+		{
+			map[int]string{pause: "net:[1]", p1: "net:[1]", p2: "net:[1]"},
+			map[string]Counts{"net:[1]": {NetRxBytes: 100}},
+			map[int]uint64{p1: 0, p2: 0},
+		},
+		{
+			map[int]string{pause: "net:[1]", p1: "net:[1]", p2: "net:[1]"},
+			map[string]Counts{"net:[1]": {NetRxBytes: 150}},
+			map[int]uint64{p1: 50, p2: 0},
+		},
+		// Another namespace: its traffic so far isn't ours.
+		{
+			map[int]string{pause: "net:[1]", p1: "net:[2]", p2: "net:[1]"},
+			map[string]Counts{"net:[1]": {NetRxBytes: 200}, "net:[2]": {NetRxBytes: 1000}},
+			map[int]uint64{p1: 0, p2: 0},
+		},
+		{
+			map[int]string{pause: "net:[1]", p1: "net:[2]", p2: "net:[1]"},
+			map[string]Counts{"net:[1]": {NetRxBytes: 250}, "net:[2]": {NetRxBytes: 1100}},
+			map[int]uint64{p1: 100, p2: 50},
+		},
+		// p1 is no longer the owner of any namespace.
+		{
+			map[int]string{pause: "net:[1]", p2: "net:[1]"},
+			map[string]Counts{"net:[1]": {NetRxBytes: 300}},
+			map[int]uint64{p1: 0, p2: 50},
+		},
+	}
+	tr := NewTracker(newNamer(n), false, false, 0, false)
+
+	for i, tc := range tests {
+		_, got, err := tr.Update(netnsIter{procInfoIter(procs...), tc.netns, tc.netdev})
+		noerr(t, err)
+		gotrx := make(map[int]uint64)
+		for _, u := range got {
+			gotrx[int(u.Start.Unix())] = u.Latest.NetRxBytes
+		}
+		if diff := cmp.Diff(gotrx, tc.want); diff != "" {
+			t.Errorf("%d: NetRxBytes differs: (-got +want)\n%s", i, diff)
+		}
+	}
+}
+
 func TestTrackerThreads(t *testing.T) {
 	p, n, tm := 1, "g1", time.Unix(0, 0).UTC()
 
@@ -130,42 +220,66 @@ func TestTrackerThreads(t *testing.T) {
 		want Update
 	}{
 		{
-			piinfo(p, n, Counts{}, Memory{}, Filedesc{1, 1}, 1),
-			Update{n, Delta{}, Memory{}, Filedesc{1, 1}, tm, 1, States{}, msi{}, nil},
+			piinfo(p, n, Counts{}, Memory{}, Filedesc{Open: 1, Limit: 1}, 1),
+			Update{GroupName: n, Filedesc: Filedesc{Open: 1, Limit: 1}, Start: tm, NumThreads: 1, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}},
 		}, {
-			piinfot(p, n, Counts{}, Memory{}, Filedesc{1, 1}, []Thread{
-				{ThreadID(ID{p, 0}), "t1", Counts{1, 2, 3, 4, 5, 6, 0, 0}, "", States{}},
-				{ThreadID(ID{p + 1, 0}), "t2", Counts{1, 1, 1, 1, 1, 1, 0, 0}, "", States{}},
+			piinfot(p, n, Counts{}, Memory{}, Filedesc{Open: 1, Limit: 1}, []Thread{
+				{ThreadID: ThreadID(ID{p, 0}), ThreadName: "t1", Counts: Counts{CPUUserTime: 1, CPUSystemTime: 2, ReadBytes: 3, WriteBytes: 4, MajorPageFaults: 5, MinorPageFaults: 6}},
+				{ThreadID: ThreadID(ID{p + 1, 0}), ThreadName: "t2", Counts: Counts{CPUUserTime: 1, CPUSystemTime: 1, ReadBytes: 1, WriteBytes: 1, MajorPageFaults: 1, MinorPageFaults: 1}, Sched: Sched{LastCPU: 3, Policy: 1, Nice: -5}},
 			}),
-			Update{n, Delta{}, Memory{}, Filedesc{1, 1}, tm, 2, States{}, msi{},
-				[]ThreadUpdate{
+			Update{
+				GroupName:  n,
+				Filedesc:   Filedesc{Open: 1, Limit: 1},
+				Start:      tm,
+				NumThreads: 2,
+				Wchans:     msi{},
+				Threads: []ThreadUpdate{
 					{"t1", Delta{}},
 					{"t2", Delta{}},
 				},
+				LastCPUs:      mii{0: 1, 3: 1},
+				SchedPolicies: mii{0: 1, 1: 1},
+				Nices:         mii{0: 1, -5: 1},
 			},
 		}, {
-			piinfot(p, n, Counts{}, Memory{}, Filedesc{1, 1}, []Thread{
-				{ThreadID(ID{p, 0}), "t1", Counts{2, 3, 4, 5, 6, 7, 0, 0}, "", States{}},
-				{ThreadID(ID{p + 1, 0}), "t2", Counts{2, 2, 2, 2, 2, 2, 0, 0}, "", States{}},
-				{ThreadID(ID{p + 2, 0}), "t2", Counts{1, 1, 1, 1, 1, 1, 0, 0}, "", States{}},
+			piinfot(p, n, Counts{}, Memory{}, Filedesc{Open: 1, Limit: 1}, []Thread{
+				{ThreadID: ThreadID(ID{p, 0}), ThreadName: "t1", Counts: Counts{CPUUserTime: 2, CPUSystemTime: 3, ReadBytes: 4, WriteBytes: 5, MajorPageFaults: 6, MinorPageFaults: 7}},
+				{ThreadID: ThreadID(ID{p + 1, 0}), ThreadName: "t2", Counts: Counts{CPUUserTime: 2, CPUSystemTime: 2, ReadBytes: 2, WriteBytes: 2, MajorPageFaults: 2, MinorPageFaults: 2}},
+				{ThreadID: ThreadID(ID{p + 2, 0}), ThreadName: "t2", Counts: Counts{CPUUserTime: 1, CPUSystemTime: 1, ReadBytes: 1, WriteBytes: 1, MajorPageFaults: 1, MinorPageFaults: 1}},
 			}),
-			Update{n, Delta{}, Memory{}, Filedesc{1, 1}, tm, 3, States{}, msi{},
-				[]ThreadUpdate{
-					{"t1", Delta{1, 1, 1, 1, 1, 1, 0, 0}},
-					{"t2", Delta{1, 1, 1, 1, 1, 1, 0, 0}},
+			Update{
+				GroupName:  n,
+				Filedesc:   Filedesc{Open: 1, Limit: 1},
+				Start:      tm,
+				NumThreads: 3,
+				Wchans:     msi{},
+				Threads: []ThreadUpdate{
+					{"t1", Delta{CPUUserTime: 1, CPUSystemTime: 1, ReadBytes: 1, WriteBytes: 1, MajorPageFaults: 1, MinorPageFaults: 1}},
+					{"t2", Delta{CPUUserTime: 1, CPUSystemTime: 1, ReadBytes: 1, WriteBytes: 1, MajorPageFaults: 1, MinorPageFaults: 1}},
 					{"t2", Delta{}},
 				},
+				LastCPUs:      mii{0: 3},
+				SchedPolicies: mii{0: 3},
+				Nices:         mii{0: 3},
 			},
 		}, {
-			piinfot(p, n, Counts{}, Memory{}, Filedesc{1, 1}, []Thread{
-				{ThreadID(ID{p, 0}), "t1", Counts{2, 3, 4, 5, 6, 7, 0, 0}, "", States{}},
-				{ThreadID(ID{p + 2, 0}), "t2", Counts{1, 2, 3, 4, 5, 6, 0, 0}, "", States{}},
+			piinfot(p, n, Counts{}, Memory{}, Filedesc{Open: 1, Limit: 1}, []Thread{
+				{ThreadID: ThreadID(ID{p, 0}), ThreadName: "t1", Counts: Counts{CPUUserTime: 2, CPUSystemTime: 3, ReadBytes: 4, WriteBytes: 5, MajorPageFaults: 6, MinorPageFaults: 7}},
+				{ThreadID: ThreadID(ID{p + 2, 0}), ThreadName: "t2", Counts: Counts{CPUUserTime: 1, CPUSystemTime: 2, ReadBytes: 3, WriteBytes: 4, MajorPageFaults: 5, MinorPageFaults: 6}},
 			}),
-			Update{n, Delta{}, Memory{}, Filedesc{1, 1}, tm, 2, States{}, msi{},
-				[]ThreadUpdate{
+			Update{
+				GroupName:  n,
+				Filedesc:   Filedesc{Open: 1, Limit: 1},
+				Start:      tm,
+				NumThreads: 2,
+				Wchans:     msi{},
+				Threads: []ThreadUpdate{
 					{"t1", Delta{}},
-					{"t2", Delta{0, 1, 2, 3, 4, 5, 0, 0}},
+					{"t2", Delta{CPUSystemTime: 1, ReadBytes: 2, WriteBytes: 3, MajorPageFaults: 4, MinorPageFaults: 5}},
 				},
+				LastCPUs:      mii{0: 2},
+				SchedPolicies: mii{0: 2},
+				Nices:         mii{0: 2},
 			},
 		},
 	}
@@ -180,3 +294,510 @@ func TestTrackerThreads(t *testing.T) {
 		}
 	}
 }
+
+// TestTrackerThreadSched verifies that scheduler and delay accounting stats
+// summed over threads
+// don't under-count when a thread exits, and that new threads count in full.
+func TestTrackerThreadSched(t *testing.T) {
+	p, n := 1, "g1"
+	thr := func(tid int, run, wait float64, slices uint64) Thread {
+		return Thread{ThreadID: ThreadID(ID{tid, 0}), ThreadName: "t",
+			Counts: Counts{CPURunTime: run, CPUWaitTime: wait, Timeslices: slices, BlkIODelayTime: wait}}
+	}
+
+	tests := []struct {
+		threads []Thread
+		want    Delta
+	}{
+		{
+			[]Thread{thr(p, 1, 1, 1), thr(p+1, 4, 4, 4)},
+			Delta{},
+		},
+		{
+			// t2 exited after running 2 more, t3 is new.
+			[]Thread{thr(p, 2, 3, 4), thr(p+2, 1, 1, 1)},
+			Delta{CPURunTime: 2, CPUWaitTime: 3, Timeslices: 4, BlkIODelayTime: 3},
+		},
+		{
+			[]Thread{thr(p, 3, 4, 5), thr(p+2, 2, 2, 2)},
+			Delta{CPURunTime: 2, CPUWaitTime: 2, Timeslices: 2, BlkIODelayTime: 2},
+		},
+	}
+	tr := NewTracker(newNamer(n), false, false, 0, false)
+
+	for i, tc := range tests {
+		_, got, err := tr.Update(procInfoIter(piinfot(p, n, Counts{}, Memory{}, Filedesc{}, tc.threads)))
+		noerr(t, err)
+		if len(got) != 1 {
+			t.Fatalf("%d: got %d updates, want 1", i, len(got))
+		}
+		if diff := cmp.Diff(got[0].Latest, tc.want); diff != "" {
+			t.Errorf("%d: latest differs: (-got +want)\n%s", i, diff)
+		}
+	}
+}
+
+// noRules provides the common.RuleMatchNamer methods for test namers
+// whose rules don't use the corresponding features.
+type noRules struct{}
+
+func (noRules) MetadataKeys() []string { return nil }
+
+func (noRules) ExcludeChild(common.ProcAttributes) bool { return false }
+
+func (noRules) HasAgeRules() bool { return false }
+
+func (noRules) AgeThresholds(common.ProcAttributes) []time.Duration { return nil }
+
+func (noRules) HasUsageRules() bool { return false }
+
+func (noRules) HasPortRules() bool { return false }
+
+func (noRules) RefreshPidfiles() []int { return nil }
+
+func (noRules) MatchAndNameUsage(common.ProcAttributes, common.Usage, common.Rule) (bool, string, common.Rule) {
+	return false, "", nil
+}
+
+// childRuleNamer is a namer whose rules all handle children using mode,
+// naming separated children parentGroup/comm, and excluding children
+// whose name is in exclude.
+type childRuleNamer struct {
+	namer
+	noRules
+	mode    common.ChildMode
+	exclude namer
+}
+
+func (n childRuleNamer) MatchAndNameRule(nacl common.ProcAttributes) (bool, string, common.Rule) {
+	if matched, name := n.MatchAndName(nacl); matched {
+		return true, name, n
+	}
+	return false, "", nil
+}
+
+func (n childRuleNamer) ExcludeChild(nacl common.ProcAttributes) bool {
+	_, excluded := n.exclude[nacl.Name]
+	return excluded
+}
+
+func (n childRuleNamer) Metadata() map[string]string { return nil }
+
+func (n childRuleNamer) ChildGroup(parentGroup string, child common.ProcAttributes) (common.ChildMode, string) {
+	return n.mode, parentGroup + "/" + child.Name
+}
+
+// TestTrackerChildRules verifies that a rule's child mode overrides the
+// tracker's trackChildren setting.
+func TestTrackerChildRules(t *testing.T) {
+	p1, p2, p3, p4 := 1, 2, 3, 4
+	n1, n2, n3, n4 := "g1", "g2", "g3", "g4"
+	t1 := time.Unix(0, 0).UTC()
+	procs := []IDInfo{
+		newProcParent(p1, n1, 0),
+		newProcParent(p2, n2, p1),
+		newProcParent(p3, n3, p2),
+		newProcParent(p4, n4, p3),
+	}
+
+	tests := []struct {
+		mode          common.ChildMode
+		trackChildren bool
+		want          []Update
+	}{
+		{
+			common.ChildSeparate, false,
+			[]Update{
+				{GroupName: n2, Start: t1, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}},
+				{GroupName: n2 + "/" + n3, Start: t1, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}},
+				{GroupName: n2 + "/" + n3, Start: t1, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}},
+			},
+		},
+		{
+			common.ChildInherit, false,
+			[]Update{
+				{GroupName: n2, Start: t1, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}},
+				{GroupName: n2, Start: t1, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}},
+				{GroupName: n2, Start: t1, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}},
+			},
+		},
+		{
+			common.ChildIgnore, true,
+			[]Update{{GroupName: n2, Start: t1, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}}},
+		},
+	}
+
+	opts := cmpopts.SortSlices(lessUpdateGroupName)
+	for i, tc := range tests {
+		tr := NewTracker(childRuleNamer{newNamer(n2), noRules{}, tc.mode, newNamer()}, tc.trackChildren, false, 0, false)
+		_, got, err := tr.Update(procInfoIter(procs...))
+		noerr(t, err)
+		if diff := cmp.Diff(got, tc.want, opts); diff != "" {
+			t.Errorf("%d: update differs: (-got +want)\n%s", i, diff)
+		}
+	}
+}
+
+// TestTrackerChildExclude verifies that excluded children and their
+// descendants aren't tracked through their ancestry.
+func TestTrackerChildExclude(t *testing.T) {
+	p1, p2, p3, p4, p5 := 1, 2, 3, 4, 5
+	n1, n2, n3, n4, n5 := "g1", "g2", "g3", "g4", "g5"
+	t1 := time.Unix(0, 0).UTC()
+	procs := []IDInfo{
+		newProcParent(p1, n1, 0),
+		newProcParent(p2, n2, p1),
+		newProcParent(p3, n3, p2),
+		newProcParent(p4, n4, p3),
+		newProcParent(p5, n5, p1),
+	}
+	want := []Update{
+		{GroupName: n1, Start: t1, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}},
+		{GroupName: n1, Start: t1, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}},
+		{GroupName: n1, Start: t1, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}},
+	}
+
+	tr := NewTracker(childRuleNamer{newNamer(n1), noRules{}, common.ChildDefault, newNamer(n3)}, true, false, 0, false)
+	_, got, err := tr.Update(procInfoIter(procs...))
+	noerr(t, err)
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("update differs: (-got +want)\n%s", diff)
+	}
+}
+
+// ageNamer names procs in young "young" until they're minAge old, and
+// procs in young or old "old" after that.
+type ageNamer struct {
+	noRules
+	young, old namer
+	minAge     time.Duration
+}
+
+func (n ageNamer) String() string { return "ageNamer" }
+
+func (n ageNamer) MatchAndName(nacl common.ProcAttributes) (bool, string) {
+	_, young := n.young[nacl.Name]
+	_, old := n.old[nacl.Name]
+	if time.Since(nacl.StartTime) >= n.minAge {
+		return young || old, "old"
+	}
+	return young, "young"
+}
+
+func (n ageNamer) MatchAndNameRule(nacl common.ProcAttributes) (bool, string, common.Rule) {
+	matched, name := n.MatchAndName(nacl)
+	return matched, name, nil
+}
+
+func (n ageNamer) HasAgeRules() bool { return true }
+
+func (n ageNamer) AgeThresholds(nacl common.ProcAttributes) []time.Duration {
+	_, young := n.young[nacl.Name]
+	_, old := n.old[nacl.Name]
+	if young || old {
+		return []time.Duration{n.minAge}
+	}
+	return nil
+}
+
+// TestTrackerAge verifies that procs are matched again once they're old
+// enough for an age-based rule, whether they were tracked or not, and that
+// with -children the descendants of a proc kept pending until then are
+// tracked along with it.  Procs no age-based rule may match aren't kept
+// pending.
+func TestTrackerAge(t *testing.T) {
+	minAge := 100 * time.Millisecond
+	start := time.Now()
+	newProcAge := func(pid, ppid int, name string) IDInfo {
+		id, static := newProcIDStatic(pid, ppid, 0, name, nil)
+		static.StartTime = start
+		return IDInfo{id, static, Metrics{}, nil}
+	}
+	e := newProcAge(5, 0, "e")
+	procs := []IDInfo{newProcAge(1, 0, "a"), newProcAge(2, 0, "b"), newProcAge(3, 2, "c"), newProcAge(4, 3, "d"), e}
+
+	tr := NewTracker(ageNamer{noRules{}, newNamer("a"), newNamer("b"), minAge}, true, false, 0, false)
+	_, got, err := tr.Update(procInfoIter(procs...))
+	noerr(t, err)
+	want := []Update{{GroupName: "young", Start: start, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}}}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("before minAge: update differs: (-got +want)\n%s", diff)
+	}
+	// No age-based rule may match e, so it's ignored rather than pending.
+	if tp, ok := tr.tracked[e.ID]; !ok || tp != nil {
+		t.Errorf("unmatched proc not ignored: %+v", tp)
+	}
+
+	time.Sleep(time.Until(start.Add(minAge)))
+	_, got, err = tr.Update(procInfoIter(procs...))
+	noerr(t, err)
+	// The metrics of pending procs aren't read, so they only join their
+	// group on the next update.
+	want = []Update{{GroupName: "old", Start: start, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}}}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("after minAge: update differs: (-got +want)\n%s", diff)
+	}
+
+	_, got, err = tr.Update(procInfoIter(procs...))
+	noerr(t, err)
+	want = []Update{
+		{GroupName: "old", Start: start, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}},
+		{GroupName: "old", Start: start, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}},
+		{GroupName: "old", Start: start, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}},
+		{GroupName: "old", Start: start, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("after minAge: update differs: (-got +want)\n%s", diff)
+	}
+
+}
+
+// portNamer names procs "port" while they listen on port.
+type portNamer struct {
+	noRules
+	port int
+}
+
+func (n portNamer) String() string { return "portNamer" }
+
+func (n portNamer) MatchAndName(nacl common.ProcAttributes) (bool, string) {
+	if nacl.ListenPorts != nil {
+		for _, port := range nacl.ListenPorts() {
+			if port == n.port {
+				return true, "port"
+			}
+		}
+	}
+	return false, ""
+}
+
+func (n portNamer) MatchAndNameRule(nacl common.ProcAttributes) (bool, string, common.Rule) {
+	matched, name := n.MatchAndName(nacl)
+	return matched, name, nil
+}
+
+func (n portNamer) HasPortRules() bool { return true }
+
+// portIter is an Iter that's also a PortSource.
+type portIter struct {
+	Iter
+	ports map[int][]int
+}
+
+func (p portIter) ListenPorts(pid int) []int { return p.ports[pid] }
+
+// TestTrackerPortLate verifies that with -children, procs that bind their
+// port a little after they start are still matched by a listening_port rule,
+// but not after listenGracePeriod.
+func TestTrackerPortLate(t *testing.T) {
+	newProcAge := func(pid int, age time.Duration) IDInfo {
+		id, static := newProcIDStatic(pid, 0, 0, "svc", nil)
+		static.StartTime = time.Now().Add(-age)
+		return IDInfo{id, static, Metrics{}, nil}
+	}
+	young, old := newProcAge(1, 0), newProcAge(2, 2*listenGracePeriod)
+	tr := NewTracker(portNamer{noRules{}, 80}, true, false, 0, false)
+
+	tests := []struct {
+		ports map[int][]int
+		want  int
+	}{
+		{map[int][]int{}, 0},
+		{map[int][]int{1: {80}, 2: {80}}, 1},
+	}
+	for i, tc := range tests {
+		_, got, err := tr.Update(portIter{procInfoIter(young, old), tc.ports})
+		noerr(t, err)
+		if len(got) != tc.want {
+			t.Errorf("%d: got %d updates, want %d: %+v", i, len(got), tc.want, got)
+		}
+		for _, u := range got {
+			if !u.Start.Equal(young.StartTime) {
+				t.Errorf("%d: got update for proc started at %v", i, u.Start)
+			}
+		}
+	}
+}
+
+// usageNamer names procs "heavy:comm" while their resident memory is at
+// least minResident, releasing them below half of that.
+type usageNamer struct {
+	noRules
+	minResident uint64
+}
+
+type usageRule struct{ noRules }
+
+func (usageRule) Metadata() map[string]string { return nil }
+
+func (usageRule) ChildGroup(string, common.ProcAttributes) (common.ChildMode, string) {
+	return common.ChildDefault, ""
+}
+
+func (n usageNamer) String() string { return "usageNamer" }
+
+func (n usageNamer) MatchAndName(common.ProcAttributes) (bool, string) { return false, "" }
+
+func (n usageNamer) MatchAndNameRule(common.ProcAttributes) (bool, string, common.Rule) {
+	return false, "", nil
+}
+
+func (n usageNamer) HasUsageRules() bool { return true }
+
+func (n usageNamer) MatchAndNameUsage(nacl common.ProcAttributes, usage common.Usage, held common.Rule) (bool, string, common.Rule) {
+	min := n.minResident
+	if held != nil {
+		min /= 2
+	}
+	if usage.ResidentBytes >= min {
+		return true, "heavy:" + nacl.Name, usageRule{}
+	}
+	return false, "", nil
+}
+
+// TestTrackerUsage verifies that procs are tracked while their resource
+// usage is high, with hysteresis.
+func TestTrackerUsage(t *testing.T) {
+	p, n := 1, "g1"
+	tm := time.Unix(0, 0).UTC()
+
+	tests := []struct {
+		resident uint64
+		heavy    bool
+	}{
+		{10, false},
+		{100, true},
+		{60, true},
+		{40, false},
+		{60, false},
+	}
+	tr := NewTracker(usageNamer{minResident: 100}, true, false, 0, false)
+	for i, tc := range tests {
+		mem := Memory{ResidentBytes: tc.resident}
+		want := []Update{}
+		if tc.heavy {
+			want = append(want, Update{GroupName: "heavy:" + n, Memory: mem, Start: tm, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}})
+		}
+		_, got, err := tr.Update(procInfoIter(newProc(p, n, Metrics{Memory: mem})))
+		noerr(t, err)
+		if diff := cmp.Diff(got, want); diff != "" {
+			t.Errorf("%d: update differs: (-got +want)\n%s", i, diff)
+		}
+	}
+}
+
+// TestTrackerUsageChildren verifies that with -children, the children of a
+// proc join its group when it starts matching a usage-based rule, whether
+// they existed before or not, and leave it when it's released.
+func TestTrackerUsageChildren(t *testing.T) {
+	newProcMem := func(pid, ppid int, name string, resident uint64) IDInfo {
+		id, static := newProcIDStatic(pid, ppid, 0, name, nil)
+		return IDInfo{id, static, Metrics{Memory: Memory{ResidentBytes: resident}}, nil}
+	}
+	kid, newKid := newProcMem(2, 1, "kid", 1), newProcMem(3, 1, "kid", 1)
+
+	tests := []struct {
+		resident uint64
+		kids     []IDInfo
+		want     map[string]int
+	}{
+		{10, []IDInfo{kid}, map[string]int{}},
+		{100, []IDInfo{kid}, map[string]int{"heavy:big": 2}},
+		{100, []IDInfo{kid, newKid}, map[string]int{"heavy:big": 3}},
+		{40, []IDInfo{kid, newKid}, map[string]int{}},
+		{100, []IDInfo{kid, newKid}, map[string]int{"heavy:big": 3}},
+	}
+	tr := NewTracker(usageNamer{minResident: 100}, true, false, 0, false)
+	for i, tc := range tests {
+		procs := append([]IDInfo{newProcMem(1, 0, "big", tc.resident)}, tc.kids...)
+		_, got, err := tr.Update(procInfoIter(procs...))
+		noerr(t, err)
+		groups := make(map[string]int)
+		for _, u := range got {
+			groups[u.GroupName]++
+		}
+		if diff := cmp.Diff(groups, tc.want); diff != "" {
+			t.Errorf("%d: groups differ: (-got +want)\n%s", i, diff)
+		}
+	}
+}
+
+// pidfileNamer names procs "master" if their PID is in pids, as a pidfile
+// rule would.
+type pidfileNamer struct {
+	noRules
+	pids map[int]bool
+}
+
+func (n pidfileNamer) String() string { return "pidfileNamer" }
+
+func (n pidfileNamer) MatchAndName(nacl common.ProcAttributes) (bool, string) {
+	return n.pids[nacl.PID], "master"
+}
+
+func (n pidfileNamer) MatchAndNameRule(nacl common.ProcAttributes) (bool, string, common.Rule) {
+	return n.pids[nacl.PID], "master", nil
+}
+
+func (n pidfileNamer) RefreshPidfiles() []int {
+	var pids []int
+	for pid, ok := range n.pids {
+		if ok {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// TestTrackerPidfile verifies that procs are matched again when a pidfile
+// starts or stops holding their PID.
+func TestTrackerPidfile(t *testing.T) {
+	p1, p2 := newProc(1, "a", Metrics{}), newProc(2, "b", Metrics{})
+	namer := pidfileNamer{pids: map[int]bool{}}
+	tr := NewTracker(namer, true, false, 0, false)
+
+	tests := []struct {
+		pids []int
+		want []Update
+	}{
+		{nil, []Update{}},
+		{[]int{2}, []Update{{GroupName: "master", Start: p2.StartTime, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}}}},
+		{[]int{1}, []Update{{GroupName: "master", Start: p1.StartTime, Wchans: msi{}, LastCPUs: mii{0: 1}, SchedPolicies: mii{0: 1}, Nices: mii{0: 1}}}},
+		{nil, []Update{}},
+	}
+	for i, tc := range tests {
+		for pid := range namer.pids {
+			delete(namer.pids, pid)
+		}
+		for _, pid := range tc.pids {
+			namer.pids[pid] = true
+		}
+		_, got, err := tr.Update(procInfoIter(p1, p2))
+		noerr(t, err)
+		if diff := cmp.Diff(got, tc.want); diff != "" {
+			t.Errorf("%d: update differs: (-got +want)\n%s", i, diff)
+		}
+	}
+}
+
+// TestTrackerPidfileChildren verifies that with -children, the children of
+// a daemon that were ignored before it wrote its pidfile are tracked once it
+// has.
+func TestTrackerPidfileChildren(t *testing.T) {
+	masterID, masterStatic := newProcIDStatic(3, 0, 0, "nginx", nil)
+	workerID, workerStatic := newProcIDStatic(4, 3, 0, "nginx", nil)
+	procs := []IDInfo{{masterID, masterStatic, Metrics{}, nil}, {workerID, workerStatic, Metrics{}, nil}}
+	namer := pidfileNamer{pids: map[int]bool{}}
+	tr := NewTracker(namer, true, false, 0, false)
+
+	for i, want := range []int{0, 2, 2} {
+		if i == 1 {
+			namer.pids[3] = true
+		}
+		_, got, err := tr.Update(procInfoIter(procs...))
+		noerr(t, err)
+		if len(got) != want {
+			t.Errorf("%d: got %d updates, want %d: %+v", i, len(got), want, got)
+		}
+	}
+}